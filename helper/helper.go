@@ -1,7 +1,11 @@
 package helper
 
 import (
+	"fmt"
+	"log"
 	"net"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
@@ -11,6 +15,15 @@ import (
 var PINetIfaces = []string{"eth0", "wlan0"}
 var PIDefaultHostname = "raspberrypi"
 
+// PatternRegexpPrefix marks an include/exclude pattern as a regular expression instead of a glob
+const PatternRegexpPrefix = "re:"
+
+// GlobalTags are added to every point reported
+var GlobalTags = map[string]string{}
+
+// MeasurementTags are added to the points of one measurement only, keyed by measurement name
+var MeasurementTags = map[string]map[string]string{}
+
 type DBInfo struct {
 	DBName   string
 	MeasName string
@@ -34,22 +47,83 @@ func GetPIName(ifName string) (string, error) {
 	return outputStr, err
 }
 
+// MatchPatterns returns true if name matches any of the patterns, either globs or regular expressions
+// starting with PatternRegexpPrefix
+func MatchPatterns(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, PatternRegexpPrefix) {
+			r, err := regexp.Compile(strings.TrimPrefix(pattern, PatternRegexpPrefix))
+			if err != nil {
+				log.Printf("Invalid pattern %s, %v\n", pattern, err)
+				continue
+			}
+			if r.MatchString(name) {
+				return true
+			}
+			continue
+		}
+
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
 // ReportStatsToInflux reports generic statistics to InfluxDB instance using the information
 // provided through the DBInfo struct
 func ReportStatsToInflux(dbInfo DBInfo, c client.Client) error {
+	_, err := ReportBatchToInflux(dbInfo.DBName, []DBInfo{dbInfo}, c)
+	return err
+}
+
+// ReportBatchToInflux reports several points to dbName with a single write, the DBName of the points
+// is ignored; it returns the number of points written, points that cannot be written (e.g. with a NaN
+// field) are left out of the batch and reported in the error
+func ReportBatchToInflux(dbName string, points []DBInfo, c client.Client) (int, error) {
 	bp, err := client.NewBatchPoints(client.BatchPointsConfig{
-		Database:  dbInfo.DBName,
+		Database:  dbName,
 		Precision: "ms",
 	})
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	point, err := client.NewPoint(dbInfo.MeasName, dbInfo.Tags, dbInfo.Fields, dbInfo.Now)
-	bp.AddPoint(point)
-	err = c.Write(bp)
-	if err != nil {
-		return err
+	var pointErr error
+	for _, dbInfo := range points {
+		point, err := client.NewPoint(dbInfo.MeasName, mergeTags(dbInfo.MeasName, dbInfo.Tags), dbInfo.Fields, dbInfo.Now)
+		if err != nil {
+			if pointErr == nil {
+				pointErr = fmt.Errorf("bad %s point, %v", dbInfo.MeasName, err)
+			}
+			continue
+		}
+		bp.AddPoint(point)
+	}
+
+	if len(bp.Points()) > 0 {
+		err = c.Write(bp)
+		if err != nil {
+			return 0, err
+		}
 	}
-	return nil
+	return len(bp.Points()), pointErr
+}
+
+func mergeTags(measName string, tags map[string]string) map[string]string {
+	// the tags set by the collector take precedence over the per-measurement tags,
+	// which take precedence over the global ones
+	output := make(map[string]string)
+	for k, v := range GlobalTags {
+		output[k] = v
+	}
+	for k, v := range MeasurementTags[measName] {
+		output[k] = v
+	}
+	for k, v := range tags {
+		output[k] = v
+	}
+
+	return output
 }
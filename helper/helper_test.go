@@ -3,8 +3,13 @@ package helper
 import (
 	"fmt"
 	"log"
+	"math"
+	"reflect"
 	"regexp"
 	"testing"
+	"time"
+
+	client "github.com/influxdata/influxdb1-client/v2"
 )
 
 func Test_GetPIName(t *testing.T) {
@@ -31,3 +36,73 @@ func Test_GetPIName(t *testing.T) {
 	}
 
 }
+
+func Test_mergeTags(t *testing.T) {
+	GlobalTags = map[string]string{"site": "london", "role": "sensor"}
+	MeasurementTags = map[string]map[string]string{"cpu_load": {"role": "kiosk", "pi_name": "ignored"}}
+	defer func() {
+		GlobalTags = map[string]string{}
+		MeasurementTags = map[string]map[string]string{}
+	}()
+
+	var tests = []struct {
+		measName string
+		tags     map[string]string
+		want     map[string]string
+	}{
+		{"cpu_load", map[string]string{"pi_name": "pi-1"},
+			map[string]string{"site": "london", "role": "kiosk", "pi_name": "pi-1"}},
+		{"disk_stats", map[string]string{"pi_name": "pi-1", "device_name": "sda"},
+			map[string]string{"site": "london", "role": "sensor", "pi_name": "pi-1", "device_name": "sda"}},
+	}
+
+	for i, tt := range tests {
+		testname := fmt.Sprintf("%d", i)
+		t.Run(testname, func(t *testing.T) {
+			got := mergeTags(tt.measName, tt.tags)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ReportStatsToInflux(t *testing.T) {
+	// the point is rejected before anything is written, so no client is needed
+	dbInfo := DBInfo{DBName: "db", MeasName: "exec", Tags: map[string]string{},
+		Fields: map[string]interface{}{"value": math.NaN()}, Now: time.Unix(1600000000, 0)}
+	err := ReportStatsToInflux(dbInfo, nil)
+	if err == nil {
+		t.Errorf("Got no error for a NaN field")
+	}
+}
+
+// fakeClient records the batches written, the other methods are not used
+type fakeClient struct {
+	client.Client
+	batches []client.BatchPoints
+}
+
+func (c *fakeClient) Write(bp client.BatchPoints) error {
+	c.batches = append(c.batches, bp)
+	return nil
+}
+
+func Test_ReportBatchToInflux(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	points := []DBInfo{
+		{MeasName: "garden", Tags: map[string]string{"sensor": "soil"}, Fields: map[string]interface{}{"moisture": 41.5}, Now: now},
+		{MeasName: "garden", Tags: map[string]string{"sensor": "air"}, Fields: map[string]interface{}{"temp": math.Inf(1)}, Now: now},
+		{MeasName: "garden", Tags: map[string]string{"sensor": "air"}, Fields: map[string]interface{}{"humidity": 40.0}, Now: now},
+	}
+
+	// the points are written at once, the one that cannot be stored is left out and reported
+	c := &fakeClient{}
+	written, err := ReportBatchToInflux("db", points, c)
+	if err == nil || written != 2 {
+		t.Errorf("Got %d points written and error %v, want 2 and an error", written, err)
+	}
+	if len(c.batches) != 1 || len(c.batches[0].Points()) != 2 || c.batches[0].Database() != "db" {
+		t.Errorf("Got %v, want one batch of 2 points", c.batches)
+	}
+}
@@ -0,0 +1,143 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// strategies to resolve the name of the PI, tried in the order they are configured
+const (
+	IdentityName      = "name"       // explicit name provided in the configuration
+	IdentityHostname  = "hostname"   // hostname, unless it is the default one
+	IdentitySerial    = "serial"     // Raspberry PI serial number
+	IdentityMachineID = "machine-id" // systemd machine ID
+	IdentityMAC       = "mac"        // MAC address of the first physical interface
+)
+
+var DefaultIdentityStrategies = []string{IdentityName, IdentityHostname, IdentitySerial, IdentityMachineID, IdentityMAC}
+
+var CPUInfoPath = "/proc/cpuinfo"
+var DeviceTreeSerialPath = "/proc/device-tree/serial-number"
+var MachineIDPath = "/etc/machine-id"
+var SysNetPath = "/sys/class/net"
+
+// ResolvePIName returns the name used to identify this PI, using the first strategy that succeeds
+// explicitName is only used by the IdentityName strategy
+func ResolvePIName(strategies []string, explicitName string) (string, error) {
+	for _, strategy := range strategies {
+		var name string
+		var err error
+
+		switch strategy {
+		case IdentityName:
+			name = explicitName
+		case IdentityHostname:
+			name, err = os.Hostname()
+			if name == PIDefaultHostname {
+				name = ""
+			}
+		case IdentitySerial:
+			name, err = getPISerial()
+			if name != "" {
+				name = "pi-" + name
+			}
+		case IdentityMachineID:
+			name, err = getMachineID()
+			if name != "" {
+				name = "pi-" + name
+			}
+		case IdentityMAC:
+			name, err = getPINameFromAnyIface()
+		default:
+			err = fmt.Errorf("unknown identity strategy %s", strategy)
+		}
+
+		if err != nil {
+			log.Printf("Identity strategy %s failed - %v\n", strategy, err)
+			continue
+		}
+		if name != "" {
+			return name, nil
+		}
+	}
+
+	return "", errors.New("could not resolve the name of the PI with any strategy")
+}
+
+func getPISerial() (string, error) {
+	// the serial is in /proc/cpuinfo on 32 bit kernels, the device tree exposes it on all of them
+	data, err := ioutil.ReadFile(CPUInfoPath)
+	if err == nil {
+		if serial := getSerialFromCPUInfo(string(data)); serial != "" {
+			return serial, nil
+		}
+	}
+
+	data, err = ioutil.ReadFile(DeviceTreeSerialPath)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimLeft(strings.Trim(string(data), "\x00\n "), "0"), nil
+}
+
+func getSerialFromCPUInfo(data string) string {
+	// given the content of /proc/cpuinfo, return the serial number without leading zeros
+	return strings.TrimLeft(getCPUInfoValue(data, "Serial"), "0")
+}
+
+func getCPUInfoValue(data, key string) string {
+	// given the content of /proc/cpuinfo, return the value of the first line with the key provided
+	for _, line := range strings.Split(data, "\n") {
+		pos := strings.Index(line, ":")
+		if pos == -1 || strings.TrimSpace(line[0:pos]) != key {
+			continue
+		}
+
+		return strings.TrimSpace(line[pos+1:])
+	}
+
+	return ""
+}
+
+func getMachineID() (string, error) {
+	data, err := ioutil.ReadFile(MachineIDPath)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func getPINameFromAnyIface() (string, error) {
+	// try the interfaces in PINetIfaces first, then any other physical interface
+	for _, elem := range PINetIfaces {
+		if name, err := GetPIName(elem); err == nil && name != "pi-" {
+			return name, nil
+		}
+	}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", err
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 || len(iface.HardwareAddr) == 0 {
+			continue
+		}
+
+		// virtual devices (bridges, docker, ...) may have random MAC addresses
+		target, err := os.Readlink(filepath.Join(SysNetPath, iface.Name))
+		if err != nil || strings.Contains(target, "/devices/virtual/") {
+			continue
+		}
+
+		return GetPIName(iface.Name)
+	}
+
+	return "", errors.New("no physical interface with a MAC address")
+}
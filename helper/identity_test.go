@@ -0,0 +1,69 @@
+package helper
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+)
+
+func Test_getSerialFromCPUInfo(t *testing.T) {
+	data, err := ioutil.ReadFile("../TestFiles/cpuinfo_sample.txt")
+	if err != nil {
+		t.Fatalf("Could not read sample file, %v\n", err)
+	}
+
+	var tests = []struct {
+		data string
+		want string
+	}{
+		{string(data), "b827eb01"},
+		{"processor	: 0\nmodel name	: ARMv7 Processor rev 4 (v7l)\n", ""},
+		{"", ""},
+	}
+
+	for i, tt := range tests {
+		testname := fmt.Sprintf("%d", i)
+		t.Run(testname, func(t *testing.T) {
+			got := getSerialFromCPUInfo(tt.data)
+			if got != tt.want {
+				t.Errorf("Got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ResolvePIName(t *testing.T) {
+	CPUInfoPath = "../TestFiles/cpuinfo_sample.txt"
+	MachineIDPath = "../TestFiles/machine-id_sample.txt"
+	DeviceTreeSerialPath = "../TestFiles/does_not_exist"
+	defer func() {
+		CPUInfoPath = "/proc/cpuinfo"
+		MachineIDPath = "/etc/machine-id"
+		DeviceTreeSerialPath = "/proc/device-tree/serial-number"
+	}()
+
+	var tests = []struct {
+		strategies   []string
+		explicitName string
+		want         string
+		wantErr      bool
+	}{
+		{DefaultIdentityStrategies, "kiosk-1", "kiosk-1", false},
+		{[]string{IdentityName, IdentitySerial}, "", "pi-b827eb01", false},
+		{[]string{IdentityMachineID}, "", "pi-fed6b2924c424cf1b9a322f606b4de6d", false},
+		{[]string{IdentityName, "bad-strategy"}, "", "", true},
+	}
+
+	for i, tt := range tests {
+		testname := fmt.Sprintf("%d", i)
+		t.Run(testname, func(t *testing.T) {
+			got, err := ResolvePIName(tt.strategies, tt.explicitName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Got error %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package helper
+
+import (
+	"io/ioutil"
+	"runtime"
+	"strings"
+)
+
+var DeviceTreeModelPath = "/proc/device-tree/model"
+var KernelReleasePath = "/proc/sys/kernel/osrelease"
+var KernelArchPath = "/proc/sys/kernel/arch"
+var OSReleasePath = "/etc/os-release"
+
+// GetInventoryTags returns tags describing the hardware and software of this PI,
+// tags that cannot be detected are left out
+func GetInventoryTags() map[string]string {
+	output := make(map[string]string)
+
+	if data, err := ioutil.ReadFile(DeviceTreeModelPath); err == nil {
+		output["pi_model"] = strings.Trim(string(data), "\x00\n ")
+	}
+
+	if data, err := ioutil.ReadFile(CPUInfoPath); err == nil {
+		if revision := getCPUInfoValue(string(data), "Revision"); revision != "" {
+			output["board_revision"] = revision
+		}
+	}
+
+	if data, err := ioutil.ReadFile(KernelReleasePath); err == nil {
+		output["kernel"] = strings.TrimSpace(string(data))
+	}
+
+	if data, err := ioutil.ReadFile(OSReleasePath); err == nil {
+		if osRelease := getOSRelease(string(data)); osRelease != "" {
+			output["os_release"] = osRelease
+		}
+	}
+
+	// the kernel may be 64 bit while this binary is 32 bit, prefer what the kernel says
+	output["arch"] = runtime.GOARCH
+	if data, err := ioutil.ReadFile(KernelArchPath); err == nil {
+		output["arch"] = strings.TrimSpace(string(data))
+	}
+
+	for k, v := range output {
+		if v == "" {
+			delete(output, k)
+		}
+	}
+
+	return output
+}
+
+func getOSRelease(data string) string {
+	// given the content of /etc/os-release, return the human readable name of the OS
+	values := make(map[string]string)
+	for _, line := range strings.Split(data, "\n") {
+		pos := strings.Index(line, "=")
+		if pos == -1 {
+			continue
+		}
+		values[line[0:pos]] = strings.Trim(line[pos+1:], "\"'")
+	}
+
+	if values["PRETTY_NAME"] != "" {
+		return values["PRETTY_NAME"]
+	}
+	return strings.TrimSpace(values["ID"] + " " + values["VERSION_ID"])
+}
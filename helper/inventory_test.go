@@ -0,0 +1,56 @@
+package helper
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func Test_GetInventoryTags(t *testing.T) {
+	DeviceTreeModelPath = "../TestFiles/device-tree_model_sample.txt"
+	CPUInfoPath = "../TestFiles/cpuinfo_sample.txt"
+	KernelReleasePath = "../TestFiles/osrelease_sample.txt"
+	KernelArchPath = "../TestFiles/arch_sample.txt"
+	OSReleasePath = "../TestFiles/os-release_sample.txt"
+	defer func() {
+		DeviceTreeModelPath = "/proc/device-tree/model"
+		CPUInfoPath = "/proc/cpuinfo"
+		KernelReleasePath = "/proc/sys/kernel/osrelease"
+		KernelArchPath = "/proc/sys/kernel/arch"
+		OSReleasePath = "/etc/os-release"
+	}()
+
+	want := map[string]string{
+		"pi_model":       "Raspberry Pi 3 Model B Rev 1.2",
+		"board_revision": "a02082",
+		"kernel":         "5.10.63-v7+",
+		"os_release":     "Raspbian GNU/Linux 10 (buster)",
+		"arch":           "armv7l",
+	}
+
+	got := GetInventoryTags()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+}
+
+func Test_getOSRelease(t *testing.T) {
+	var tests = []struct {
+		data string
+		want string
+	}{
+		{"PRETTY_NAME=\"Debian GNU/Linux 12 (bookworm)\"\nID=debian\n", "Debian GNU/Linux 12 (bookworm)"},
+		{"ID=alpine\nVERSION_ID=3.14.2\n", "alpine 3.14.2"},
+		{"", ""},
+	}
+
+	for i, tt := range tests {
+		testname := fmt.Sprintf("%d", i)
+		t.Run(testname, func(t *testing.T) {
+			got := getOSRelease(tt.data)
+			if got != tt.want {
+				t.Errorf("Got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package helper
+
+import "sync"
+
+var shutdownHooks []func()
+var shutdownMutex sync.Mutex
+
+// OnShutdown registers a function run by RunShutdownHooks when pi-reporter is stopped, collectors use it
+// to save state that is otherwise only saved periodically
+func OnShutdown(hook func()) {
+	shutdownMutex.Lock()
+	defer shutdownMutex.Unlock()
+	shutdownHooks = append(shutdownHooks, hook)
+}
+
+// RunShutdownHooks runs the registered functions in the order they were registered
+func RunShutdownHooks() {
+	shutdownMutex.Lock()
+	hooks := append([]func(){}, shutdownHooks...)
+	shutdownMutex.Unlock()
+
+	for _, hook := range hooks {
+		hook()
+	}
+}
@@ -0,0 +1,19 @@
+package helper
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_RunShutdownHooks(t *testing.T) {
+	defer func() { shutdownHooks = nil }()
+
+	var got []int
+	OnShutdown(func() { got = append(got, 1) })
+	OnShutdown(func() { got = append(got, 2) })
+	RunShutdownHooks()
+
+	if want := []int{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+}
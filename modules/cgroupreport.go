@@ -0,0 +1,481 @@
+package modules
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dpinato/pi-reporter/helper"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+const DefaultCgroupReportTime = 30 * time.Second
+const BaseCgroupDir = "/sys/fs/cgroup/"
+const DockerDataDir = "/var/lib/docker/"
+const PodmanStorageDir = "/var/lib/containers/storage/"
+const CgroupMeasurementsName = "cgroup_stats"
+
+// kinds of cgroup reported
+const (
+	CgroupKindContainer = "container"
+	CgroupKindSlice     = "slice"
+	CgroupKindService   = "service"
+	CgroupKindScope     = "scope"
+)
+
+// CgroupUnlimited is reported for limits that are not set, i.e. "max" in cgroup v2
+const CgroupUnlimited = -1
+
+// CgroupIncludePatterns selects other cgroups to report by path, e.g. system.slice/*.service;
+// containers and top level slices are always reported
+var CgroupIncludePatterns = []string{}
+
+// cgroupContainerID matches the directories of Docker and Podman containers, i.e.
+// docker-<id>.scope and libpod-<id>.scope with the systemd driver, <id> and libpod-<id> with cgroupfs
+var cgroupContainerID = regexp.MustCompile(`^(docker-|libpod-)?([0-9a-f]{64})(\.scope)?$`)
+
+// CgroupStats contains the resource usage of one cgroup
+type CgroupStats struct {
+	Path    string // relative to the root of the hierarchy, e.g. system.slice/docker-<id>.scope
+	Name    string // name of the container, or of the slice or unit
+	Kind    string
+	Runtime string // docker or podman, containers only
+
+	CPUUsage      int64 // microseconds
+	CPUUser       int64
+	CPUSystem     int64
+	NrThrottled   int64 // cgroup v2 only
+	ThrottledUsec int64
+	MemoryCurrent int64 // bytes
+	MemoryMax     int64 // bytes, CgroupUnlimited when not set
+	IOReadBytes   int64
+	IOWriteBytes  int64
+	IOReadOps     int64
+	IOWriteOps    int64
+	PidsCurrent   int64
+	PidsMax       int64 // CgroupUnlimited when not set
+}
+
+// CgroupRates contains the rates computed between two consecutive samples of the same cgroup
+type CgroupRates struct {
+	CPUPercent         float64 // percentage of one core
+	IOReadBytesPerSec  float64
+	IOWriteBytesPerSec float64
+}
+
+func ReportCgroupStats(dbName, piName string, c client.Client) error {
+	log.Printf("ReportCgroupStats() is starting, %s\n", piName)
+
+	prevStats := make(map[string]CgroupStats)
+	prevTime := time.Now()
+
+	ticker := time.NewTicker(DefaultCgroupReportTime)
+	for {
+		select {
+		case t := <-ticker.C:
+			stats, err := getCgroupStats(BaseCgroupDir)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+
+			// cgroups that went away are forgotten, a restarted container gets a new cgroup
+			currStats := make(map[string]CgroupStats)
+			for _, elem := range stats {
+				currStats[elem.Path] = elem
+				prev, ok := prevStats[elem.Path]
+				if !ok {
+					continue
+				}
+
+				rates := getCgroupRates(prev, elem, t.Sub(prevTime))
+				err = reportCgroupStatsToInflux(dbName, piName, elem, rates, t, c)
+				if err != nil {
+					log.Println(err)
+				}
+			}
+			prevStats = currStats
+			prevTime = t
+		}
+	}
+}
+
+func getCgroupStats(baseDir string) ([]CgroupStats, error) {
+	// cgroup v2 has a single hierarchy with cgroup.controllers at its root,
+	// cgroup v1 has one hierarchy per controller and memory is used to find the cgroups
+	v2 := isCgroupV2(baseDir)
+	rootDir := baseDir
+	if !v2 {
+		rootDir = filepath.Join(baseDir, "memory")
+	}
+
+	paths, err := getCgroupPaths(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var output []CgroupStats
+	for _, path := range paths {
+		stat, ok := classifyCgroup(path)
+		if !ok {
+			continue
+		}
+
+		if v2 {
+			getCgroupV2Stats(filepath.Join(baseDir, path), &stat)
+		} else {
+			getCgroupV1Stats(baseDir, path, &stat)
+		}
+		output = append(output, stat)
+	}
+
+	return output, nil
+}
+
+func isCgroupV2(baseDir string) bool {
+	_, err := os.Stat(filepath.Join(baseDir, "cgroup.controllers"))
+	return err == nil
+}
+
+func getCgroupPaths(rootDir string) ([]string, error) {
+	// return the paths of all the cgroups under rootDir, relative to it
+	var output []string
+	err := filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// cgroups may go away while walking the tree
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() || path == rootDir {
+			return nil
+		}
+
+		rel, err := filepath.Rel(rootDir, path)
+		if err != nil {
+			return err
+		}
+		output = append(output, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(output)
+	return output, nil
+}
+
+func classifyCgroup(path string) (CgroupStats, bool) {
+	// return a CgroupStats with the name and kind of the cgroup, and false if it is not reported
+	stat := CgroupStats{Path: path}
+	base := filepath.Base(path)
+	parent := filepath.Base(filepath.Dir(path))
+
+	if m := cgroupContainerID.FindStringSubmatch(base); m != nil {
+		switch {
+		case m[1] == "docker-" || (m[1] == "" && parent == "docker"):
+			stat.Runtime = "docker"
+		case m[1] == "libpod-":
+			stat.Runtime = "podman"
+		}
+		if stat.Runtime != "" {
+			stat.Kind = CgroupKindContainer
+			stat.Name = resolveContainerName(stat.Runtime, m[2])
+			return stat, true
+		}
+	}
+
+	stat.Name = base
+	switch {
+	case strings.HasSuffix(base, ".slice"):
+		stat.Kind = CgroupKindSlice
+	case strings.HasSuffix(base, ".service"):
+		stat.Kind = CgroupKindService
+	default:
+		stat.Kind = CgroupKindScope
+	}
+
+	topSlice := stat.Kind == CgroupKindSlice && !strings.Contains(path, "/")
+	if topSlice || helper.MatchPatterns(CgroupIncludePatterns, path) {
+		return stat, true
+	}
+	return stat, false
+}
+
+var containerNameCache = make(map[string]string)
+
+func resolveContainerName(runtime, id string) string {
+	// return the name given to the container, or the short ID when it cannot be found
+	// only called from the collector goroutine, so the cache does not need a lock
+	if name, ok := containerNameCache[id]; ok {
+		return name
+	}
+
+	var name string
+	switch runtime {
+	case "docker":
+		name = getDockerContainerName(DockerDataDir, id)
+	case "podman":
+		name = getPodmanContainerName(PodmanStorageDir, id)
+	}
+	if name == "" {
+		// not cached, the metadata of new containers may not be written yet
+		return id[0:12]
+	}
+
+	containerNameCache[id] = name
+	return name
+}
+
+func getDockerContainerName(dockerDir, id string) string {
+	// the name is in containers/<id>/config.v2.json, with a leading slash
+	data, err := ioutil.ReadFile(filepath.Join(dockerDir, "containers", id, "config.v2.json"))
+	if err != nil {
+		return ""
+	}
+
+	var config struct {
+		Name string
+	}
+	if json.Unmarshal(data, &config) != nil {
+		return ""
+	}
+	return strings.TrimPrefix(config.Name, "/")
+}
+
+func getPodmanContainerName(storageDir, id string) string {
+	// podman lists its containers in overlay-containers/containers.json
+	data, err := ioutil.ReadFile(filepath.Join(storageDir, "overlay-containers", "containers.json"))
+	if err != nil {
+		return ""
+	}
+
+	var containers []struct {
+		ID    string   `json:"id"`
+		Names []string `json:"names"`
+	}
+	if json.Unmarshal(data, &containers) != nil {
+		return ""
+	}
+	for _, elem := range containers {
+		if elem.ID == id && len(elem.Names) > 0 {
+			return elem.Names[0]
+		}
+	}
+	return ""
+}
+
+func getCgroupV2Stats(dir string, stat *CgroupStats) {
+	// files missing because a controller is not enabled for the cgroup leave their fields at 0
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "cpu.stat"))
+	cpu := getCgroupKeyValues(string(data))
+	stat.CPUUsage = cpu["usage_usec"]
+	stat.CPUUser = cpu["user_usec"]
+	stat.CPUSystem = cpu["system_usec"]
+	stat.NrThrottled = cpu["nr_throttled"]
+	stat.ThrottledUsec = cpu["throttled_usec"]
+
+	stat.MemoryCurrent = readCgroupValue(filepath.Join(dir, "memory.current"))
+	stat.MemoryMax = readCgroupValue(filepath.Join(dir, "memory.max"))
+	stat.PidsCurrent = readCgroupValue(filepath.Join(dir, "pids.current"))
+	stat.PidsMax = readCgroupValue(filepath.Join(dir, "pids.max"))
+
+	data, _ = ioutil.ReadFile(filepath.Join(dir, "io.stat"))
+	getIOStatFromString(string(data), stat)
+}
+
+func getCgroupV1Stats(baseDir, path string, stat *CgroupStats) {
+	// each controller has its own hierarchy, usually with the same paths
+	// cpuacct reports nanoseconds and user/system in clock ticks
+	usage := readCgroupValue(filepath.Join(baseDir, "cpuacct", path, "cpuacct.usage"))
+	if usage > 0 {
+		stat.CPUUsage = usage / 1000
+	}
+	data, _ := ioutil.ReadFile(filepath.Join(baseDir, "cpuacct", path, "cpuacct.stat"))
+	cpu := getCgroupKeyValues(string(data))
+	stat.CPUUser = cpu["user"] * 1000000 / ProcClockTicks
+	stat.CPUSystem = cpu["system"] * 1000000 / ProcClockTicks
+
+	stat.MemoryCurrent = readCgroupValue(filepath.Join(baseDir, "memory", path, "memory.usage_in_bytes"))
+	stat.MemoryMax = readCgroupValue(filepath.Join(baseDir, "memory", path, "memory.limit_in_bytes"))
+	if stat.MemoryMax >= 1<<62 {
+		// no limit is reported as the largest multiple of the page size
+		stat.MemoryMax = CgroupUnlimited
+	}
+	stat.PidsCurrent = readCgroupValue(filepath.Join(baseDir, "pids", path, "pids.current"))
+	stat.PidsMax = readCgroupValue(filepath.Join(baseDir, "pids", path, "pids.max"))
+
+	data, _ = ioutil.ReadFile(filepath.Join(baseDir, "blkio", path, "blkio.throttle.io_service_bytes"))
+	stat.IOReadBytes, stat.IOWriteBytes = getBlkioFromString(string(data))
+	data, _ = ioutil.ReadFile(filepath.Join(baseDir, "blkio", path, "blkio.throttle.io_serviced"))
+	stat.IOReadOps, stat.IOWriteOps = getBlkioFromString(string(data))
+}
+
+func readCgroupValue(path string) int64 {
+	// return the value in the file, CgroupUnlimited for "max" and 0 when it cannot be read
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+
+	value := strings.TrimSpace(string(data))
+	if value == "max" {
+		return CgroupUnlimited
+	}
+	v, _ := strconv.ParseInt(value, 10, 64)
+	return v
+}
+
+func getCgroupKeyValues(data string) map[string]int64 {
+	// cpu.stat and cpuacct.stat have one key and value per line, e.g. usage_usec 4521
+	output := make(map[string]int64)
+	for _, line := range strings.Split(data, "\n") {
+		list := strings.Fields(line)
+		if len(list) != 2 {
+			continue
+		}
+
+		v, err := strconv.ParseInt(list[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		output[list[0]] = v
+	}
+
+	return output
+}
+
+func getIOStatFromString(data string, stat *CgroupStats) {
+	// io.stat has one line per device, the values of all devices are added up
+	// 179:0 rbytes=1459200 wbytes=314773504 rios=192 wios=353 dbytes=0 dios=0
+	for _, line := range strings.Split(data, "\n") {
+		list := strings.Fields(line)
+		for i := 1; i < len(list); i++ {
+			pos := strings.Index(list[i], "=")
+			if pos == -1 {
+				continue
+			}
+
+			v, err := strconv.ParseInt(list[i][pos+1:], 10, 64)
+			if err != nil {
+				continue
+			}
+			switch list[i][0:pos] {
+			case "rbytes":
+				stat.IOReadBytes += v
+			case "wbytes":
+				stat.IOWriteBytes += v
+			case "rios":
+				stat.IOReadOps += v
+			case "wios":
+				stat.IOWriteOps += v
+			}
+		}
+	}
+}
+
+func getBlkioFromString(data string) (int64, int64) {
+	// return the reads and writes of all devices, lines are like 179:0 Read 1459200
+	var read, write int64
+	for _, line := range strings.Split(data, "\n") {
+		list := strings.Fields(line)
+		if len(list) != 3 {
+			continue
+		}
+
+		v, err := strconv.ParseInt(list[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch list[1] {
+		case "Read":
+			read += v
+		case "Write":
+			write += v
+		}
+	}
+
+	return read, write
+}
+
+func getCgroupRates(pStat, nStat CgroupStats, elapsed time.Duration) CgroupRates {
+	// pStat is the previous sample of the cgroup, nStat is the latest one
+	var rates CgroupRates
+	if elapsed <= 0 {
+		return rates
+	}
+
+	seconds := elapsed.Seconds()
+	if nStat.CPUUsage >= pStat.CPUUsage {
+		rates.CPUPercent = float64(nStat.CPUUsage-pStat.CPUUsage) / 1000000.0 / seconds * 100.0
+	}
+	if nStat.IOReadBytes >= pStat.IOReadBytes {
+		rates.IOReadBytesPerSec = float64(nStat.IOReadBytes-pStat.IOReadBytes) / seconds
+	}
+	if nStat.IOWriteBytes >= pStat.IOWriteBytes {
+		rates.IOWriteBytesPerSec = float64(nStat.IOWriteBytes-pStat.IOWriteBytes) / seconds
+	}
+
+	return rates
+}
+
+func reportCgroupStatsToInflux(dbName, piName string, stat CgroupStats, rates CgroupRates, now time.Time, c client.Client) error {
+	tags := map[string]string{
+		"pi_name": piName,
+		"name":    stat.Name,
+		"kind":    stat.Kind,
+	}
+
+	fields := map[string]interface{}{
+		"cpu_usage_usec":         stat.CPUUsage,
+		"cpu_user_usec":          stat.CPUUser,
+		"cpu_system_usec":        stat.CPUSystem,
+		"cpu_percent":            rates.CPUPercent,
+		"memory_current":         stat.MemoryCurrent,
+		"io_read_bytes":          stat.IOReadBytes,
+		"io_write_bytes":         stat.IOWriteBytes,
+		"io_read_ops":            stat.IOReadOps,
+		"io_write_ops":           stat.IOWriteOps,
+		"io_read_bytes_per_sec":  rates.IOReadBytesPerSec,
+		"io_write_bytes_per_sec": rates.IOWriteBytesPerSec,
+		"pids_current":           stat.PidsCurrent,
+		"nr_throttled":           stat.NrThrottled,
+		"throttled_usec":         stat.ThrottledUsec,
+	}
+	// the path of a container has its ID, a new series for every container run would grow the index
+	if stat.Kind == CgroupKindContainer {
+		tags["runtime"] = stat.Runtime
+		fields["cgroup_path"] = stat.Path
+	} else {
+		tags["cgroup"] = stat.Path
+	}
+	if stat.MemoryMax > 0 {
+		fields["memory_max"] = stat.MemoryMax
+		fields["memory_used_percent"] = float64(stat.MemoryCurrent) / float64(stat.MemoryMax) * 100.0
+	}
+	if stat.PidsMax > 0 {
+		fields["pids_max"] = stat.PidsMax
+	}
+
+	var dbInfoObj helper.DBInfo
+	dbInfoObj.DBName = dbName
+	dbInfoObj.MeasName = CgroupMeasurementsName
+	dbInfoObj.Tags = tags
+	dbInfoObj.Fields = fields
+	dbInfoObj.Now = now
+
+	err := helper.ReportStatsToInflux(dbInfoObj, c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package modules
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testDockerID = "aaaa000000000000000000000000000000000000000000000000000000000001"
+const testPodmanID = "bbbb000000000000000000000000000000000000000000000000000000000002"
+
+func Test_getCgroupStatsV2(t *testing.T) {
+	CgroupIncludePatterns = []string{"system.slice/ssh.service"}
+	defer func() { CgroupIncludePatterns = []string{} }()
+
+	got, err := getCgroupStats("../TestFiles/cgroup2/")
+	if err != nil {
+		t.Fatalf("Got error, %v\n", err)
+	}
+
+	ioTotals := CgroupStats{IOReadBytes: 1463296, IOWriteBytes: 314781696, IOReadOps: 193, IOWriteOps: 355}
+	withIO := func(stat CgroupStats) CgroupStats {
+		stat.IOReadBytes, stat.IOWriteBytes = ioTotals.IOReadBytes, ioTotals.IOWriteBytes
+		stat.IOReadOps, stat.IOWriteOps = ioTotals.IOReadOps, ioTotals.IOWriteOps
+		stat.PidsMax = CgroupUnlimited
+		return stat
+	}
+	want := []CgroupStats{
+		// machine.slice has no files of its own in the sample
+		{Path: "machine.slice", Name: "machine.slice", Kind: CgroupKindSlice},
+		withIO(CgroupStats{Path: "machine.slice/libpod-" + testPodmanID + ".scope", Name: testPodmanID[0:12],
+			Kind: CgroupKindContainer, Runtime: "podman", CPUUsage: 2000000, CPUUser: 1500000, CPUSystem: 500000,
+			MemoryCurrent: 52428800, MemoryMax: CgroupUnlimited, PidsCurrent: 8}),
+		withIO(CgroupStats{Path: "system.slice", Name: "system.slice", Kind: CgroupKindSlice,
+			CPUUsage: 8000000, CPUUser: 6000000, CPUSystem: 2000000, MemoryCurrent: 524288000,
+			MemoryMax: CgroupUnlimited, PidsCurrent: 120}),
+		withIO(CgroupStats{Path: "system.slice/docker-" + testDockerID + ".scope", Name: testDockerID[0:12],
+			Kind: CgroupKindContainer, Runtime: "docker", CPUUsage: 4000000, CPUUser: 3000000, CPUSystem: 1000000,
+			MemoryCurrent: 104857600, MemoryMax: 268435456, PidsCurrent: 12}),
+		withIO(CgroupStats{Path: "system.slice/ssh.service", Name: "ssh.service", Kind: CgroupKindService,
+			CPUUsage: 200000, CPUUser: 150000, CPUSystem: 50000, MemoryCurrent: 4194304,
+			MemoryMax: CgroupUnlimited, PidsCurrent: 3}),
+		withIO(CgroupStats{Path: "user.slice", Name: "user.slice", Kind: CgroupKindSlice,
+			CPUUsage: 1000000, CPUUser: 750000, CPUSystem: 250000, MemoryCurrent: 52428800,
+			MemoryMax: CgroupUnlimited, PidsCurrent: 20}),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %+v\nwant %+v", got, want)
+	}
+}
+
+func Test_getCgroupStatsV1(t *testing.T) {
+	got, err := getCgroupStats("../TestFiles/cgroup1/")
+	if err != nil {
+		t.Fatalf("Got error, %v\n", err)
+	}
+
+	want := []CgroupStats{
+		{Path: "docker/" + testDockerID, Name: testDockerID[0:12], Kind: CgroupKindContainer, Runtime: "docker",
+			CPUUsage: 4000000, CPUUser: 3000000, CPUSystem: 1000000, MemoryCurrent: 104857600,
+			MemoryMax: CgroupUnlimited, IOReadBytes: 1459200, IOWriteBytes: 314773504, IOReadOps: 192,
+			IOWriteOps: 353, PidsCurrent: 12, PidsMax: CgroupUnlimited},
+		{Path: "system.slice", Name: "system.slice", Kind: CgroupKindSlice, MemoryCurrent: 524288000,
+			MemoryMax: CgroupUnlimited},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %+v\nwant %+v", got, want)
+	}
+}
+
+func Test_getContainerNames(t *testing.T) {
+	if got := getDockerContainerName("../TestFiles/docker/", testDockerID); got != "homeassistant" {
+		t.Errorf("Got %s, want homeassistant", got)
+	}
+	if got := getPodmanContainerName("../TestFiles/podman/", testPodmanID); got != "pihole" {
+		t.Errorf("Got %s, want pihole", got)
+	}
+	if got := getDockerContainerName("../TestFiles/docker/", testPodmanID); got != "" {
+		t.Errorf("Got %s for an unknown container, want an empty name", got)
+	}
+}
+
+func Test_getCgroupRates(t *testing.T) {
+	prev := CgroupStats{CPUUsage: 1000000, IOReadBytes: 1000, IOWriteBytes: 5000}
+	curr := CgroupStats{CPUUsage: 16000000, IOReadBytes: 31000, IOWriteBytes: 5000}
+
+	got := getCgroupRates(prev, curr, 30*time.Second)
+	want := CgroupRates{CPUPercent: 50, IOReadBytesPerSec: 1000, IOWriteBytesPerSec: 0}
+	if got != want {
+		t.Errorf("Got %+v, want %+v", got, want)
+	}
+}
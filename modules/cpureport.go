@@ -1,10 +1,8 @@
 package modules
 
 import (
-	"fmt"
 	"io/ioutil"
 	"log"
-	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -20,6 +18,7 @@ type CPULoad struct {
 
 // CPUCoreLoad contains statistics for one CPU core, and the whole package (first line of /proc/stat)
 type CPUCoreLoad struct {
+	Name      string // cpu for the whole package, cpuN for the cores
 	User      int64
 	Nice      int64
 	System    int64
@@ -32,23 +31,34 @@ type CPUCoreLoad struct {
 	GuestNice int64
 }
 
+// CPUCoreUsage contains the percentage of time spent in each state by one CPU core, or the whole package,
+// between two samples
+type CPUCoreUsage struct {
+	Name      string
+	Usage     float64 // time not spent idle or waiting for I/O
+	User      float64
+	Nice      float64
+	System    float64
+	Idle      float64
+	IoWait    float64
+	Irq       float64
+	Softirq   float64
+	Steal     float64
+	Guest     float64
+	GuestNice float64
+}
+
 const DefaultCPUReportTime = 30 * time.Second
 const CPUStatsFile = "/proc/stat"
 const CPUMeasurementsName = "cpu_load"
 
-func ReportCPUUsage(dbName string, c client.Client) {
-	var err error
+// CPUPackageTag is the value of the cpu tag for the whole package
+const CPUPackageTag = "cpu-total"
 
-	myName, _ := helper.GetPIName(helper.PINetIfaces[0])
-	hostname, err := os.Hostname()
-	if err != nil {
-		log.Printf("Failed to get hostname - %+v", err)
-		hostname = myName
-	} else if hostname == helper.PIDefaultHostname {
-		hostname = myName
-	}
+func ReportCPUUsage(dbName, piName string, c client.Client) {
+	var err error
 
-	log.Printf("ReportCPUUsage() is starting, %s\n", hostname)
+	log.Printf("ReportCPUUsage() is starting, %s\n", piName)
 
 	// get first load sample
 	rawPrevStat, _ := ioutil.ReadFile(CPUStatsFile)
@@ -65,7 +75,7 @@ func ReportCPUUsage(dbName string, c client.Client) {
 			currLoad := getCPUUsage(prevStat, currStat)
 
 			// report to InfluxDB
-			err = reportCPUUsageToInflux(dbName, hostname, currLoad, t, c)
+			err = reportCPUUsageToInflux(dbName, piName, currLoad, t, c)
 			if err != nil {
 				log.Println(err)
 			}
@@ -75,27 +85,51 @@ func ReportCPUUsage(dbName string, c client.Client) {
 	}
 }
 
-func getCPUUsage(pStat, nStat CPULoad) []float64 {
+func getCPUUsage(pStat, nStat CPULoad) []CPUCoreUsage {
 	// pStat is the previous point of CPU usage
-	// pStat is the latest point of CPU usage
+	// nStat is the latest point of CPU usage
 	// followed this response for the calculations below
 	// https://stackoverflow.com/questions/23367857/accurate-calculation-of-cpu-usage-given-in-percentage-in-linux
-	outputLoad := make([]float64, len(pStat.Stats))
+	var outputLoad []CPUCoreUsage
 
-	for i := 0; i < len(pStat.Stats); i++ {
-		prevIdle := pStat.Stats[i].Idle + pStat.Stats[i].IoWait
-		idle := nStat.Stats[i].Idle + nStat.Stats[i].IoWait
+	prevByName := make(map[string]CPUCoreLoad)
+	for _, elem := range pStat.Stats {
+		prevByName[elem.Name] = elem
+	}
 
-		prevNonIdle := pStat.Stats[i].User + pStat.Stats[i].Nice + pStat.Stats[i].System + pStat.Stats[i].Irq + pStat.Stats[i].Softirq + pStat.Stats[i].Steal
-		nonIdle := nStat.Stats[i].User + nStat.Stats[i].Nice + nStat.Stats[i].System + nStat.Stats[i].Irq + nStat.Stats[i].Softirq + nStat.Stats[i].Steal
+	for _, curr := range nStat.Stats {
+		// cores may go offline between samples, only compare cores present in both
+		prev, ok := prevByName[curr.Name]
+		if !ok {
+			continue
+		}
 
-		prevTotal := prevIdle + prevNonIdle
-		total := idle + nonIdle
+		// guest time is already accounted in user and nice time
+		prevTotal := prev.User + prev.Nice + prev.System + prev.Idle + prev.IoWait + prev.Irq + prev.Softirq + prev.Steal
+		total := curr.User + curr.Nice + curr.System + curr.Idle + curr.IoWait + curr.Irq + curr.Softirq + curr.Steal
+		totald := float64(total - prevTotal)
+		if totald <= 0 {
+			continue
+		}
 
-		totald := total - prevTotal
-		idled := idle - prevIdle
+		percent := func(prevVal, currVal int64) float64 {
+			return float64(currVal-prevVal) / totald * 100.0
+		}
 
-		outputLoad[i] = float64(totald-idled) / float64(totald)
+		usage := CPUCoreUsage{Name: curr.Name}
+		usage.User = percent(prev.User, curr.User)
+		usage.Nice = percent(prev.Nice, curr.Nice)
+		usage.System = percent(prev.System, curr.System)
+		usage.Idle = percent(prev.Idle, curr.Idle)
+		usage.IoWait = percent(prev.IoWait, curr.IoWait)
+		usage.Irq = percent(prev.Irq, curr.Irq)
+		usage.Softirq = percent(prev.Softirq, curr.Softirq)
+		usage.Steal = percent(prev.Steal, curr.Steal)
+		usage.Guest = percent(prev.Guest, curr.Guest)
+		usage.GuestNice = percent(prev.GuestNice, curr.GuestNice)
+		usage.Usage = 100.0 - usage.Idle - usage.IoWait
+
+		outputLoad = append(outputLoad, usage)
 	}
 
 	return outputLoad
@@ -111,6 +145,7 @@ func readCPUUsage(data string) CPULoad {
 			var tmpLoad CPUCoreLoad
 			list := strings.Split(line, " ")
 
+			tmpLoad.Name = list[0]
 			tmpLoad.User, _ = strconv.ParseInt(list[1], 10, 64)
 			tmpLoad.Nice, _ = strconv.ParseInt(list[2], 10, 64)
 			tmpLoad.System, _ = strconv.ParseInt(list[3], 10, 64)
@@ -129,27 +164,42 @@ func readCPUUsage(data string) CPULoad {
 	return loadObj
 }
 
-func reportCPUUsageToInflux(dbName, piName string, load []float64, now time.Time, c client.Client) error {
-	tags := map[string]string{
-		"pi_name": piName,
-	}
-	fields := map[string]interface{}{}
-	fields["cpu"] = load[0]
-	for i, elem := range load[1:] {
-		key := fmt.Sprintf("cpu_%d", i)
-		fields[key] = elem
-	}
+func reportCPUUsageToInflux(dbName, piName string, load []CPUCoreUsage, now time.Time, c client.Client) error {
+	for _, elem := range load {
+		cpuName := elem.Name
+		if cpuName == "cpu" {
+			cpuName = CPUPackageTag
+		}
 
-	var dbInfoObj helper.DBInfo
-	dbInfoObj.DBName = dbName
-	dbInfoObj.MeasName = CPUMeasurementsName
-	dbInfoObj.Tags = tags
-	dbInfoObj.Fields = fields
-	dbInfoObj.Now = now
+		tags := map[string]string{
+			"pi_name": piName,
+			"cpu":     cpuName,
+		}
+		fields := map[string]interface{}{
+			"usage":      elem.Usage,
+			"user":       elem.User,
+			"nice":       elem.Nice,
+			"system":     elem.System,
+			"idle":       elem.Idle,
+			"iowait":     elem.IoWait,
+			"irq":        elem.Irq,
+			"softirq":    elem.Softirq,
+			"steal":      elem.Steal,
+			"guest":      elem.Guest,
+			"guest_nice": elem.GuestNice,
+		}
 
-	err := helper.ReportStatsToInflux(dbInfoObj, c)
-	if err != nil {
-		return err
+		var dbInfoObj helper.DBInfo
+		dbInfoObj.DBName = dbName
+		dbInfoObj.MeasName = CPUMeasurementsName
+		dbInfoObj.Tags = tags
+		dbInfoObj.Fields = fields
+		dbInfoObj.Now = now
+
+		err := helper.ReportStatsToInflux(dbInfoObj, c)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -0,0 +1,55 @@
+package modules
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+)
+
+func Test_readCPUUsage(t *testing.T) {
+	data, err := ioutil.ReadFile("../TestFiles/stat_sample_1.txt")
+	if err != nil {
+		t.Fatalf("Could not read sample file, %v\n", err)
+	}
+
+	got := readCPUUsage(string(data))
+	if len(got.Stats) != 5 {
+		t.Fatalf("Got %d cores, want 5", len(got.Stats))
+	}
+
+	want := CPUCoreLoad{Name: "cpu1", User: 2500, Nice: 200, System: 700, Idle: 20000, IoWait: 500, Irq: 25, Softirq: 100}
+	if got.Stats[2] != want {
+		t.Errorf("Got %+v, want %+v", got.Stats[2], want)
+	}
+	if got.Stats[0].Name != "cpu" {
+		t.Errorf("Got package name %s, want cpu", got.Stats[0].Name)
+	}
+}
+
+func Test_getCPUUsage(t *testing.T) {
+	data1, err := ioutil.ReadFile("../TestFiles/stat_sample_1.txt")
+	if err != nil {
+		t.Fatalf("Could not read sample file, %v\n", err)
+	}
+	data2, err := ioutil.ReadFile("../TestFiles/stat_sample_2.txt")
+	if err != nil {
+		t.Fatalf("Could not read sample file, %v\n", err)
+	}
+
+	got := getCPUUsage(readCPUUsage(string(data1)), readCPUUsage(string(data2)))
+
+	// cpu3 went offline in the second sample
+	if len(got) != 4 {
+		t.Fatalf("Got %d cores, want 4", len(got))
+	}
+
+	for i, elem := range got {
+		testname := fmt.Sprintf("%d", i)
+		t.Run(testname, func(t *testing.T) {
+			want := CPUCoreUsage{Name: elem.Name, Usage: 40, User: 20, System: 10, Idle: 40, IoWait: 20, Softirq: 10}
+			if elem != want {
+				t.Errorf("Got %+v, want %+v", elem, want)
+			}
+		})
+	}
+}
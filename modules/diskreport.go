@@ -5,7 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
-	"os"
+	"math"
 	"reflect"
 	"regexp"
 	"strconv"
@@ -21,6 +21,14 @@ const DiskStatsPath = "/proc/diskstats"
 const DiskMeasurementsName = "disk_stats"
 const DiskNameRegexp = "sd|mmcblk"
 
+// DiskSectorSize is the size of the sectors counted in /proc/diskstats, which is always 512 bytes
+// regardless of the sector size of the underlying device
+const DiskSectorSize = 512
+
+// DiskReportRawCounters adds the raw cumulative counters from /proc/diskstats to each point,
+// alongside the rates computed between samples
+var DiskReportRawCounters = false
+
 // DiskStats is based on reading the fields in /proc/diskstats
 // /proc/diskstats format: https://www.kernel.org/doc/Documentation/ABI/testing/procfs-diskstats
 // more: https://www.kernel.org/doc/Documentation/block/stat.txt
@@ -46,17 +54,22 @@ type DiskStats struct {
 	FlushingTicks  int64 `json:"flushing_ticks"`      // time spent flushing (ms)
 }
 
-func ReportDiskStats(dbName string, c client.Client) error {
-	myName, _ := helper.GetPIName(helper.PINetIfaces[0])
-	hostname, err := os.Hostname()
-	if err != nil {
-		log.Printf("Failed to get hostname - %+v", err)
-		hostname = myName
-	} else if hostname == helper.PIDefaultHostname {
-		hostname = myName
-	}
+// DiskRates contains the rates computed between two consecutive DiskStats samples of the same device
+type DiskRates struct {
+	DevName string `json:"device_name"`
 
-	log.Printf("ReportDiskStats() is starting, %s\n", hostname)
+	ReadBytesPerSec  float64 `json:"read_bytes_per_sec"`
+	WriteBytesPerSec float64 `json:"write_bytes_per_sec"`
+	ReadIOPS         float64 `json:"read_iops"`
+	WriteIOPS        float64 `json:"write_iops"`
+	ReadLatency      float64 `json:"read_latency"`    // average time per read (ms)
+	WriteLatency     float64 `json:"write_latency"`   // average time per write (ms)
+	Utilisation      float64 `json:"utilisation"`     // percentage of time the device was busy
+	AvgQueueDepth    float64 `json:"avg_queue_depth"` // average number of I/Os in progress
+}
+
+func ReportDiskStats(dbName, piName string, c client.Client) error {
+	log.Printf("ReportDiskStats() is starting, %s\n", piName)
 
 	r, err := regexp.Compile(DiskNameRegexp)
 	if err != nil {
@@ -65,6 +78,13 @@ func ReportDiskStats(dbName string, c client.Client) error {
 
 	}
 
+	// get first sample, rates are computed against the previous sample of each device
+	prevStats, err := getDiskStats(r)
+	if err != nil {
+		log.Println(err)
+	}
+	prevTime := time.Now()
+
 	ticker := time.NewTicker(DefaultDiskReportTime)
 	for {
 		select {
@@ -75,12 +95,27 @@ func ReportDiskStats(dbName string, c client.Client) error {
 				continue
 			}
 
-			for _, elem := range stats {
-				err = reportDiskStatsToInflux(dbName, hostname, elem, t, c)
+			for devName, elem := range stats {
+				prev, ok := prevStats[devName]
+				if !ok {
+					// new device, wait for the next sample
+					continue
+				}
+
+				rates, ok := getDiskRates(prev, elem, t.Sub(prevTime))
+				if !ok {
+					log.Printf("Counters for %s were reset, skipping sample\n", devName)
+					continue
+				}
+
+				err = reportDiskStatsToInflux(dbName, piName, elem, rates, t, c)
 				if err != nil {
 					log.Println(err)
 				}
 			}
+
+			prevStats = stats
+			prevTime = t
 		}
 	}
 }
@@ -157,14 +192,79 @@ func getDiskStatsFromLine(sampleLine string) DiskStats {
 	return outStats
 }
 
-func reportDiskStatsToInflux(dbName, piName string, stat DiskStats, now time.Time, c client.Client) error {
+func getDiskRates(pStat, nStat DiskStats, elapsed time.Duration) (DiskRates, bool) {
+	// pStat is the previous sample of the device, nStat is the latest one
+	// returns false if the counters went backwards for a reason other than a wraparound,
+	// i.e. the device was removed and added back, in which case nStat becomes the new baseline
+	rates := DiskRates{DevName: nStat.DevName}
+	if elapsed <= 0 {
+		return rates, false
+	}
+
+	valid := true
+	delta := func(prev, curr int64) int64 {
+		d, ok := counterDelta(prev, curr)
+		valid = valid && ok
+		return d
+	}
+	readIOs := delta(pStat.ReadIOs, nStat.ReadIOs)
+	writeIOs := delta(pStat.WriteIOs, nStat.WriteIOs)
+	readSectors := delta(pStat.ReadSectors, nStat.ReadSectors)
+	writeSectors := delta(pStat.WriteSectors, nStat.WriteSectors)
+	readTicks := delta(pStat.ReadTicks, nStat.ReadTicks)
+	writeTicks := delta(pStat.WriteTicks, nStat.WriteTicks)
+	ioTicks := delta(pStat.IoTicks, nStat.IoTicks)
+	timeInQueue := delta(pStat.TimeInQueue, nStat.TimeInQueue)
+	if !valid {
+		return rates, false
+	}
+
+	seconds := elapsed.Seconds()
+	millis := seconds * 1000.0
+
+	rates.ReadBytesPerSec = float64(readSectors*DiskSectorSize) / seconds
+	rates.WriteBytesPerSec = float64(writeSectors*DiskSectorSize) / seconds
+	rates.ReadIOPS = float64(readIOs) / seconds
+	rates.WriteIOPS = float64(writeIOs) / seconds
+	if readIOs > 0 {
+		rates.ReadLatency = float64(readTicks) / float64(readIOs)
+	}
+	if writeIOs > 0 {
+		rates.WriteLatency = float64(writeTicks) / float64(writeIOs)
+	}
+	rates.Utilisation = float64(ioTicks) / millis * 100.0
+	if rates.Utilisation > 100.0 {
+		// io_ticks is updated in jiffies, so it can slightly overshoot the elapsed time
+		rates.Utilisation = 100.0
+	}
+	rates.AvgQueueDepth = float64(timeInQueue) / millis
+
+	return rates, true
+}
+
+func counterDelta(prev, curr int64) (int64, bool) {
+	// return the increase of a counter between two samples
+	// the counters in /proc/diskstats are unsigned longs, so they wrap at 32 bits on 32 bit kernels;
+	// a counter that goes backwards from a value that could not have wrapped means it was reset
+	if curr >= prev {
+		return curr - prev, true
+	}
+
+	if prev <= math.MaxUint32 && prev > math.MaxUint32/2 {
+		return (math.MaxUint32 - prev) + curr + 1, true
+	}
+
+	return 0, false
+}
+
+func reportDiskStatsToInflux(dbName, piName string, stat DiskStats, rates DiskRates, now time.Time, c client.Client) error {
 	tags := map[string]string{
 		"pi_name":     piName,
 		"device_name": stat.DevName,
 	}
 
 	fields := map[string]interface{}{}
-	v := reflect.ValueOf(stat)
+	v := reflect.ValueOf(rates)
 	typeOfS := v.Type()
 	for i := 1; i < v.NumField(); i++ {
 		// skip DevName
@@ -173,6 +273,16 @@ func reportDiskStatsToInflux(dbName, piName string, stat DiskStats, now time.Tim
 		fields[fieldName] = fieldVal
 	}
 
+	if DiskReportRawCounters {
+		v = reflect.ValueOf(stat)
+		typeOfS = v.Type()
+		for i := 1; i < v.NumField(); i++ {
+			fieldName := typeOfS.Field(i).Name
+			fieldVal := v.Field(i).Interface()
+			fields[fieldName] = fieldVal
+		}
+	}
+
 	var dbInfoObj helper.DBInfo
 	dbInfoObj.DBName = dbName
 	dbInfoObj.MeasName = DiskMeasurementsName
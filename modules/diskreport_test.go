@@ -2,8 +2,10 @@ package modules
 
 import (
 	"fmt"
+	"math"
 	"regexp"
 	"testing"
+	"time"
 )
 
 func Test_getDiskStats(t *testing.T) {
@@ -107,3 +109,65 @@ func Test_getDiskStatsFromLine(t *testing.T) {
 		})
 	}
 }
+
+func Test_getDiskRates(t *testing.T) {
+	prev := DiskStats{DevName: "mmcblk0", ReadIOs: 1000, ReadSectors: 8000, ReadTicks: 500,
+		WriteIOs: 2000, WriteSectors: 16000, WriteTicks: 4000, IoTicks: 10000, TimeInQueue: 20000}
+
+	var tests = []struct {
+		curr      DiskStats
+		elapsed   time.Duration
+		wantOk    bool
+		wantRates DiskRates
+	}{
+		{DiskStats{DevName: "mmcblk0", ReadIOs: 1100, ReadSectors: 8800, ReadTicks: 700,
+			WriteIOs: 2300, WriteSectors: 22000, WriteTicks: 4600, IoTicks: 13000, TimeInQueue: 35000},
+			10 * time.Second, true,
+			DiskRates{DevName: "mmcblk0", ReadBytesPerSec: 40960, WriteBytesPerSec: 307200,
+				ReadIOPS: 10, WriteIOPS: 30, ReadLatency: 2, WriteLatency: 2,
+				Utilisation: 30, AvgQueueDepth: 1.5}},
+		// no activity
+		{prev, 10 * time.Second, true, DiskRates{DevName: "mmcblk0"}},
+		// device was removed and added back
+		{DiskStats{DevName: "mmcblk0", ReadIOs: 10, ReadSectors: 80},
+			10 * time.Second, false, DiskRates{}},
+		{prev, 0, false, DiskRates{}},
+	}
+
+	for i, tt := range tests {
+		testname := fmt.Sprintf("%d", i)
+		t.Run(testname, func(t *testing.T) {
+			got, ok := getDiskRates(prev, tt.curr, tt.elapsed)
+			if ok != tt.wantOk {
+				t.Fatalf("Got ok %v, want %v", ok, tt.wantOk)
+			}
+			if ok && got != tt.wantRates {
+				t.Errorf("Got %+v, want %+v", got, tt.wantRates)
+			}
+		})
+	}
+}
+
+func Test_counterDelta(t *testing.T) {
+	var tests = []struct {
+		prev, curr int64
+		wantDelta  int64
+		wantOk     bool
+	}{
+		{100, 150, 50, true},
+		{100, 100, 0, true},
+		{math.MaxUint32 - 9, 5, 15, true},    // 32 bit wraparound
+		{1000, 10, 0, false},                 // reset
+		{math.MaxUint32 + 100, 10, 0, false}, // 64 bit counters do not wrap
+	}
+
+	for i, tt := range tests {
+		testname := fmt.Sprintf("%d", i)
+		t.Run(testname, func(t *testing.T) {
+			got, ok := counterDelta(tt.prev, tt.curr)
+			if got != tt.wantDelta || ok != tt.wantOk {
+				t.Errorf("Got %d %v, want %d %v", got, ok, tt.wantDelta, tt.wantOk)
+			}
+		})
+	}
+}
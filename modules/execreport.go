@@ -0,0 +1,325 @@
+package modules
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/dpinato/pi-reporter/helper"
+	"github.com/influxdata/influxdb1-client/models"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+const ExecStatusMeasurementsName = "exec_status"
+
+// output formats of the commands
+const (
+	ExecFormatLineProtocol = "lp"   // InfluxDB line protocol, the measurement and tags come from the output
+	ExecFormatJSON         = "json" // an object, or an array of objects, whose values are the fields
+	ExecFormatKeyValue     = "kv"   // key=value pairs separated by spaces or new lines
+)
+
+// ExecCommands are the commands run, the collector is disabled when empty
+var ExecCommands = []ExecCommand{}
+
+// ExecCommand is one command whose output is reported
+type ExecCommand struct {
+	Name     string // measurement of the points of json and kv commands
+	Interval time.Duration
+	Timeout  time.Duration
+	Format   string
+	Command  string // run with /bin/sh -c
+}
+
+// runExecCommand runs the command and returns its standard output, killing it and its children
+// after the timeout; tests replace it with a fake
+var runExecCommand = func(command string, timeout time.Duration) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// a process group of its own, so children of the script that keep the output open are killed too
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	err := cmd.Start()
+	if err != nil {
+		return "", err
+	}
+	timer := time.AfterFunc(timeout, func() {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	})
+	err = cmd.Wait()
+	if !timer.Stop() {
+		return "", fmt.Errorf("timed out after %v", timeout)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%v, %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.String(), nil
+}
+
+// ParseExecConfig parses the content of the file configuring the commands, one command per line like
+// <name> <interval> <timeout> <format> <command>, e.g. bme280 30s 10s kv /usr/local/bin/bme280.sh
+// empty lines and lines starting with # are ignored
+func ParseExecConfig(data string) ([]ExecCommand, error) {
+	var output []ExecCommand
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// the command is the rest of the line, its own spacing is kept
+		var list []string
+		for j := 0; j < 4 && line != ""; j++ {
+			pos := strings.IndexAny(line, " \t")
+			if pos == -1 {
+				pos = len(line)
+			}
+			list = append(list, line[0:pos])
+			line = strings.TrimSpace(line[pos:])
+		}
+		if len(list) != 4 || line == "" {
+			return nil, fmt.Errorf("line %d: expected <name> <interval> <timeout> <format> <command>", i+1)
+		}
+
+		cmd := ExecCommand{Name: list[0], Format: list[3], Command: line}
+		var err error
+		cmd.Interval, err = time.ParseDuration(list[1])
+		if err != nil || cmd.Interval <= 0 {
+			return nil, fmt.Errorf("line %d: bad interval %s", i+1, list[1])
+		}
+		cmd.Timeout, err = time.ParseDuration(list[2])
+		if err != nil || cmd.Timeout <= 0 {
+			return nil, fmt.Errorf("line %d: bad timeout %s", i+1, list[2])
+		}
+		switch cmd.Format {
+		case ExecFormatLineProtocol, ExecFormatJSON, ExecFormatKeyValue:
+		default:
+			return nil, fmt.Errorf("line %d: unknown format %s", i+1, cmd.Format)
+		}
+
+		output = append(output, cmd)
+	}
+
+	return output, nil
+}
+
+func ReportExecStats(dbName, piName string, c client.Client) error {
+	if len(ExecCommands) == 0 {
+		return errors.New("no exec commands configured")
+	}
+
+	log.Printf("ReportExecStats() is starting, %s\n", piName)
+
+	// each command runs on its own interval, so a slow command does not delay the others
+	var wg sync.WaitGroup
+	for _, cmd := range ExecCommands {
+		wg.Add(1)
+		go func(cmd ExecCommand) {
+			defer wg.Done()
+			ticker := time.NewTicker(cmd.Interval)
+			for {
+				select {
+				case t := <-ticker.C:
+					runExecToInflux(dbName, piName, cmd, t, c)
+				}
+			}
+		}(cmd)
+	}
+	wg.Wait()
+
+	return nil
+}
+
+func runExecToInflux(dbName, piName string, cmd ExecCommand, now time.Time, c client.Client) {
+	start := time.Now()
+	out, err := runExecCommand(cmd.Command, cmd.Timeout)
+	duration := time.Since(start)
+
+	var points []helper.DBInfo
+	if err == nil {
+		points, err = parseExecOutput(cmd, out, now)
+	}
+	if err != nil {
+		log.Printf("Command %s failed, %v\n", cmd.Name, err)
+	}
+
+	// the points of a run are written at once, only the points written are counted and a point
+	// InfluxDB cannot store fails the run
+	written := 0
+	if len(points) > 0 {
+		for _, elem := range points {
+			elem.Tags["pi_name"] = piName
+		}
+		var writeErr error
+		written, writeErr = helper.ReportBatchToInflux(dbName, points, c)
+		if writeErr != nil {
+			log.Printf("Command %s failed, %v\n", cmd.Name, writeErr)
+			err = writeErr
+		}
+	}
+
+	tags := map[string]string{
+		"pi_name": piName,
+		"exec":    cmd.Name,
+	}
+	fields := map[string]interface{}{
+		"success":     err == nil,
+		"duration_ms": float64(duration) / float64(time.Millisecond),
+		"points":      written,
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+
+	var dbInfoObj helper.DBInfo
+	dbInfoObj.DBName = dbName
+	dbInfoObj.MeasName = ExecStatusMeasurementsName
+	dbInfoObj.Tags = tags
+	dbInfoObj.Fields = fields
+	dbInfoObj.Now = now
+
+	err = helper.ReportStatsToInflux(dbInfoObj, c)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+func parseExecOutput(cmd ExecCommand, out string, now time.Time) ([]helper.DBInfo, error) {
+	// return the points in the output of cmd, without DBName; points of json and kv commands
+	// are named after the command and have the time of the run
+	switch cmd.Format {
+	case ExecFormatLineProtocol:
+		return parseLineProtocol(out, now)
+	case ExecFormatJSON:
+		return parseExecJSON(cmd.Name, out, now)
+	case ExecFormatKeyValue:
+		fields := parseExecKeyValues(out)
+		if len(fields) == 0 {
+			return nil, errors.New("no key=value pairs in output")
+		}
+		return []helper.DBInfo{{MeasName: cmd.Name, Tags: map[string]string{}, Fields: fields, Now: now}}, nil
+	}
+
+	return nil, fmt.Errorf("unknown format %s", cmd.Format)
+}
+
+func parseLineProtocol(data string, now time.Time) ([]helper.DBInfo, error) {
+	// points without a timestamp get now, timestamps are in nanoseconds
+	points, err := models.ParsePointsWithPrecision([]byte(data), now, "n")
+	if err != nil {
+		return nil, err
+	}
+
+	var output []helper.DBInfo
+	for _, point := range points {
+		fields, err := point.Fields()
+		if err != nil {
+			return nil, err
+		}
+		output = append(output, helper.DBInfo{
+			MeasName: string(point.Name()),
+			Tags:     point.Tags().Map(),
+			Fields:   fields,
+			Now:      point.Time(),
+		})
+	}
+
+	return output, nil
+}
+
+func parseExecJSON(name, data string, now time.Time) ([]helper.DBInfo, error) {
+	// nested objects are flattened, e.g. {"bme280": {"temp": 21.5}} becomes the field bme280_temp
+	var objects []map[string]interface{}
+	trimmed := strings.TrimSpace(data)
+	if strings.HasPrefix(trimmed, "[") {
+		err := json.Unmarshal([]byte(trimmed), &objects)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var object map[string]interface{}
+		err := json.Unmarshal([]byte(trimmed), &object)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+
+	var output []helper.DBInfo
+	for _, object := range objects {
+		fields := make(map[string]interface{})
+		flattenExecJSON("", object, fields)
+		if len(fields) == 0 {
+			continue
+		}
+		output = append(output, helper.DBInfo{MeasName: name, Tags: map[string]string{}, Fields: fields, Now: now})
+	}
+
+	if len(output) == 0 {
+		return nil, errors.New("no values in output")
+	}
+	return output, nil
+}
+
+func flattenExecJSON(prefix string, object map[string]interface{}, fields map[string]interface{}) {
+	keys := make([]string, 0, len(object))
+	for k := range object {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		key := k
+		if prefix != "" {
+			key = prefix + "_" + k
+		}
+
+		switch v := object[k].(type) {
+		case float64, bool, string:
+			fields[key] = v
+		case map[string]interface{}:
+			flattenExecJSON(key, v, fields)
+		}
+		// null values and arrays are ignored
+	}
+}
+
+func parseExecKeyValues(data string) map[string]interface{} {
+	// values are numbers, true/false or strings without spaces, optionally between double quotes
+	output := make(map[string]interface{})
+	for _, elem := range strings.Fields(data) {
+		pos := strings.Index(elem, "=")
+		if pos < 1 {
+			continue
+		}
+
+		key, value := elem[0:pos], elem[pos+1:]
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			// NaN and infinite values cannot be stored
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				log.Printf("Skipping %s, %s cannot be stored\n", key, value)
+				continue
+			}
+			output[key] = v
+		} else if v, err := strconv.ParseBool(value); err == nil && (value == "true" || value == "false") {
+			output[key] = v
+		} else {
+			output[key] = strings.Trim(value, "\"")
+		}
+	}
+
+	return output
+}
@@ -0,0 +1,119 @@
+package modules
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dpinato/pi-reporter/helper"
+)
+
+func Test_ParseExecConfig(t *testing.T) {
+	config := `# name interval timeout format command
+bme280 30s 10s kv /usr/local/bin/bme280.sh --bus 1
+
+speedtest	1h 2m	json   speedtest-cli --json | jq '.download'
+`
+	got, err := ParseExecConfig(config)
+	if err != nil {
+		t.Fatalf("Got error, %v\n", err)
+	}
+	want := []ExecCommand{
+		{"bme280", 30 * time.Second, 10 * time.Second, ExecFormatKeyValue, "/usr/local/bin/bme280.sh --bus 1"},
+		{"speedtest", time.Hour, 2 * time.Minute, ExecFormatJSON, "speedtest-cli --json | jq '.download'"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+
+	for _, bad := range []string{"bme280 30s 10s kv", "bme280 0s 10s kv cmd", "bme280 30s x kv cmd", "bme280 30s 10s xml cmd"} {
+		if _, err := ParseExecConfig(bad); err == nil {
+			t.Errorf("Got no error for %s", bad)
+		}
+	}
+}
+
+func Test_parseExecOutput(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+
+	var tests = []struct {
+		name   string
+		format string
+		out    string
+		want   []helper.DBInfo
+	}{
+		{"lp", ExecFormatLineProtocol,
+			"garden,sensor=soil moisture=41.5,dry=false\ngarden,sensor=air temp=18i 1600000001000000000\n",
+			[]helper.DBInfo{
+				{MeasName: "garden", Tags: map[string]string{"sensor": "soil"},
+					Fields: map[string]interface{}{"moisture": 41.5, "dry": false}, Now: now},
+				{MeasName: "garden", Tags: map[string]string{"sensor": "air"},
+					Fields: map[string]interface{}{"temp": int64(18)}, Now: time.Unix(1600000001, 0)},
+			}},
+		{"json", ExecFormatJSON,
+			`{"temperature": 21.5, "ok": true, "model": "bme280", "extra": {"pressure": 1013}, "list": [1], "none": null}`,
+			[]helper.DBInfo{
+				{MeasName: "json", Tags: map[string]string{},
+					Fields: map[string]interface{}{"temperature": 21.5, "ok": true, "model": "bme280",
+						"extra_pressure": 1013.0}, Now: now},
+			}},
+		{"json array", ExecFormatJSON, `[{"a": 1}, {"b": 2}]`,
+			[]helper.DBInfo{
+				{MeasName: "json array", Tags: map[string]string{}, Fields: map[string]interface{}{"a": 1.0}, Now: now},
+				{MeasName: "json array", Tags: map[string]string{}, Fields: map[string]interface{}{"b": 2.0}, Now: now},
+			}},
+		{"kv", ExecFormatKeyValue, "temp=21.5 humidity=40\nstatus=\"ok\" alarm=false bad\n",
+			[]helper.DBInfo{
+				{MeasName: "kv", Tags: map[string]string{},
+					Fields: map[string]interface{}{"temp": 21.5, "humidity": 40.0, "status": "ok", "alarm": false}, Now: now},
+			}},
+		{"kv nan", ExecFormatKeyValue, "temp=21.5 humidity=NaN pressure=+Inf",
+			[]helper.DBInfo{
+				{MeasName: "kv nan", Tags: map[string]string{}, Fields: map[string]interface{}{"temp": 21.5}, Now: now},
+			}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseExecOutput(ExecCommand{Name: tt.name, Format: tt.format}, tt.out, now)
+			if err != nil {
+				t.Fatalf("Got error, %v\n", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i].MeasName != tt.want[i].MeasName || !reflect.DeepEqual(got[i].Tags, tt.want[i].Tags) ||
+					!reflect.DeepEqual(got[i].Fields, tt.want[i].Fields) || !got[i].Now.Equal(tt.want[i].Now) {
+					t.Errorf("Got %v, want %v", got[i], tt.want[i])
+				}
+			}
+		})
+	}
+
+	for _, format := range []string{ExecFormatLineProtocol, ExecFormatJSON, ExecFormatKeyValue} {
+		if _, err := parseExecOutput(ExecCommand{Name: "bad", Format: format}, "not valid", now); err == nil {
+			t.Errorf("Got no error for bad %s output", format)
+		}
+	}
+}
+
+func Test_runExecCommand(t *testing.T) {
+	got, err := runExecCommand("echo temp=21.5", time.Second)
+	if err != nil || got != "temp=21.5\n" {
+		t.Errorf("Got %q and error %v, want temp=21.5", got, err)
+	}
+
+	_, err = runExecCommand("echo broken >&2; exit 3", time.Second)
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("Got error %v, want the standard error of the command", err)
+	}
+
+	// the child keeps the output open, it has to be killed with the shell
+	start := time.Now()
+	_, err = runExecCommand("sleep 10 & sleep 10", 100*time.Millisecond)
+	if err == nil || time.Since(start) > 5*time.Second {
+		t.Errorf("Got error %v after %v, want a timeout", err, time.Since(start))
+	}
+}
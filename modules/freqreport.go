@@ -0,0 +1,231 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dpinato/pi-reporter/helper"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+const DefaultFreqReportTime = 30 * time.Second
+const BaseCPUFreqDir = "/sys/devices/system/cpu/"
+const ThrottledPath = "/sys/devices/platform/soc/soc:firmware/get_throttled"
+const FreqMeasurementsName = "cpu_freq"
+const ThrottledMeasurementsName = "cpu_throttling"
+
+// ThrottledCommand is run when ThrottledPath is not available, it prints something like throttled=0x50005
+var ThrottledCommand = []string{"vcgencmd", "get_throttled"}
+
+const ThrottledCommandTimeout = 5 * time.Second
+
+// ThrottledBits maps the bits of the get_throttled value to the name of the field reported
+// https://www.raspberrypi.com/documentation/computers/os.html#get_throttled
+var ThrottledBits = map[uint]string{
+	0:  "under_voltage",
+	1:  "freq_capped",
+	2:  "throttled",
+	3:  "soft_temp_limit",
+	16: "under_voltage_occurred",
+	17: "freq_capped_occurred",
+	18: "throttled_occurred",
+	19: "soft_temp_limit_occurred",
+}
+
+// CPUFreqStats contains the frequency scaling statistics of one CPU core
+type CPUFreqStats struct {
+	CPUName     string
+	CurFreq     int64            // current frequency (kHz)
+	MinFreq     int64            // minimum frequency allowed by the governor (kHz)
+	MaxFreq     int64            // maximum frequency allowed by the governor (kHz)
+	Governor    string           // scaling governor, e.g. ondemand
+	TimeInState map[string]int64 // time spent at each frequency (kHz), in units of 10ms
+}
+
+func ReportCPUFreqStats(dbName, piName string, c client.Client) error {
+	log.Printf("ReportCPUFreqStats() is starting, %s\n", piName)
+
+	// boards without cpufreq and without the firmware interface have nothing to report
+	freqStats, freqErr := getCPUFreqStats(BaseCPUFreqDir)
+	_, throttledErr := getThrottled()
+	if (freqErr != nil || len(freqStats) == 0) && throttledErr != nil {
+		log.Printf("ReportCPUFreqStats() is disabled, %v, %v\n", freqErr, throttledErr)
+		return errors.New("no CPU frequency statistics available")
+	}
+
+	ticker := time.NewTicker(DefaultFreqReportTime)
+	for {
+		select {
+		case t := <-ticker.C:
+			stats, err := getCPUFreqStats(BaseCPUFreqDir)
+			if err != nil {
+				log.Println(err)
+			}
+			for _, elem := range stats {
+				err = reportCPUFreqStatsToInflux(dbName, piName, elem, t, c)
+				if err != nil {
+					log.Println(err)
+				}
+			}
+
+			throttled, err := getThrottled()
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			err = reportThrottledToInflux(dbName, piName, throttled, t, c)
+			if err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+func getCPUFreqStats(baseDir string) ([]CPUFreqStats, error) {
+	// read the cpufreq statistics of every core in baseDir, normally /sys/devices/system/cpu/
+	cpuDirs, err := filepath.Glob(filepath.Join(baseDir, "cpu[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+
+	var output []CPUFreqStats
+	for _, cpuDir := range cpuDirs {
+		freqDir := filepath.Join(cpuDir, "cpufreq")
+		if _, err := ioutil.ReadDir(freqDir); err != nil {
+			// core is offline or has no frequency scaling
+			continue
+		}
+
+		var stats CPUFreqStats
+		stats.CPUName = filepath.Base(cpuDir)
+		stats.CurFreq, _ = readSysfsInt(filepath.Join(freqDir, "scaling_cur_freq"))
+		stats.MinFreq, _ = readSysfsInt(filepath.Join(freqDir, "scaling_min_freq"))
+		stats.MaxFreq, _ = readSysfsInt(filepath.Join(freqDir, "scaling_max_freq"))
+		governor, _ := ioutil.ReadFile(filepath.Join(freqDir, "scaling_governor"))
+		stats.Governor = strings.TrimSpace(string(governor))
+
+		timeInState, err := ioutil.ReadFile(filepath.Join(freqDir, "stats", "time_in_state"))
+		if err == nil {
+			stats.TimeInState = getTimeInState(string(timeInState))
+		}
+
+		output = append(output, stats)
+	}
+
+	return output, nil
+}
+
+func getTimeInState(data string) map[string]int64 {
+	// each line of time_in_state contains a frequency (kHz) and the time spent at it (10ms)
+	output := make(map[string]int64)
+	for _, line := range strings.Split(data, "\n") {
+		list := strings.Fields(line)
+		if len(list) != 2 {
+			continue
+		}
+
+		value, err := strconv.ParseInt(list[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		output[list[0]] = value
+	}
+
+	return output
+}
+
+func getThrottled() (int64, error) {
+	// the firmware exposes the throttled state in sysfs on recent kernels, otherwise ask vcgencmd
+	data, err := ioutil.ReadFile(ThrottledPath)
+	if err == nil {
+		return parseThrottled(string(data))
+	}
+
+	if len(ThrottledCommand) == 0 {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ThrottledCommandTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, ThrottledCommand[0], ThrottledCommand[1:]...).Output()
+	if err != nil {
+		return 0, err
+	}
+	return parseThrottled(string(out))
+}
+
+func parseThrottled(data string) (int64, error) {
+	// data is either the content of get_throttled, e.g. 50005, or the output of
+	// vcgencmd get_throttled, e.g. throttled=0x50005; both are hexadecimal
+	data = strings.TrimSpace(data)
+	data = strings.TrimPrefix(data, "throttled=")
+	data = strings.TrimPrefix(data, "0x")
+	return strconv.ParseInt(data, 16, 64)
+}
+
+func getThrottledFields(throttled int64) map[string]interface{} {
+	// decode the bits of the get_throttled value into individual fields
+	fields := map[string]interface{}{}
+	fields["throttled_raw"] = throttled
+	for bit, name := range ThrottledBits {
+		fields[name] = throttled&(1<<bit) != 0
+	}
+
+	return fields
+}
+
+func reportCPUFreqStatsToInflux(dbName, piName string, stat CPUFreqStats, now time.Time, c client.Client) error {
+	tags := map[string]string{
+		"pi_name": piName,
+		"cpu":     stat.CPUName,
+	}
+	fields := map[string]interface{}{}
+	fields["cur_freq"] = stat.CurFreq
+	fields["min_freq"] = stat.MinFreq
+	fields["max_freq"] = stat.MaxFreq
+	if stat.Governor != "" {
+		fields["governor"] = stat.Governor
+	}
+	for k, v := range stat.TimeInState {
+		fields["time_in_state_"+k] = v
+	}
+
+	var dbInfoObj helper.DBInfo
+	dbInfoObj.DBName = dbName
+	dbInfoObj.MeasName = FreqMeasurementsName
+	dbInfoObj.Tags = tags
+	dbInfoObj.Fields = fields
+	dbInfoObj.Now = now
+
+	err := helper.ReportStatsToInflux(dbInfoObj, c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func reportThrottledToInflux(dbName, piName string, throttled int64, now time.Time, c client.Client) error {
+	tags := map[string]string{
+		"pi_name": piName,
+	}
+
+	var dbInfoObj helper.DBInfo
+	dbInfoObj.DBName = dbName
+	dbInfoObj.MeasName = ThrottledMeasurementsName
+	dbInfoObj.Tags = tags
+	dbInfoObj.Fields = getThrottledFields(throttled)
+	dbInfoObj.Now = now
+
+	err := helper.ReportStatsToInflux(dbInfoObj, c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
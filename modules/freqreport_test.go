@@ -0,0 +1,81 @@
+package modules
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func Test_getCPUFreqStats(t *testing.T) {
+	got, err := getCPUFreqStats("../TestFiles/sys/devices/system/cpu/")
+	if err != nil {
+		t.Fatalf("Got error, %v\n", err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("Got %d cores, want 2", len(got))
+	}
+
+	want := CPUFreqStats{
+		CPUName:     "cpu1",
+		CurFreq:     1500000,
+		MinFreq:     600000,
+		MaxFreq:     1500000,
+		Governor:    "ondemand",
+		TimeInState: map[string]int64{"600000": 123456, "700000": 100, "1500000": 45678},
+	}
+	if !reflect.DeepEqual(got[1], want) {
+		t.Errorf("Got %+v, want %+v", got[1], want)
+	}
+}
+
+func Test_parseThrottled(t *testing.T) {
+	sample, err := ioutil.ReadFile("../TestFiles/get_throttled_sample.txt")
+	if err != nil {
+		t.Fatalf("Could not read sample file, %v\n", err)
+	}
+
+	var tests = []struct {
+		data    string
+		want    int64
+		wantErr bool
+	}{
+		{string(sample), 0x50005, false},
+		{"throttled=0x0\n", 0, false},
+		{"throttled=0xe0000\n", 0xe0000, false},
+		{"error=1 error_msg=\"Command not registered\"", 0, true},
+	}
+
+	for i, tt := range tests {
+		testname := fmt.Sprintf("%d", i)
+		t.Run(testname, func(t *testing.T) {
+			got, err := parseThrottled(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("Got %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getThrottledFields(t *testing.T) {
+	got := getThrottledFields(0x50005)
+
+	want := map[string]interface{}{
+		"throttled_raw":            int64(0x50005),
+		"under_voltage":            true,
+		"freq_capped":              false,
+		"throttled":                true,
+		"soft_temp_limit":          false,
+		"under_voltage_occurred":   true,
+		"freq_capped_occurred":     false,
+		"throttled_occurred":       true,
+		"soft_temp_limit_occurred": false,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+}
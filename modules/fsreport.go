@@ -0,0 +1,205 @@
+package modules
+
+import (
+	"io/ioutil"
+	"log"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dpinato/pi-reporter/helper"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+const DefaultFSReportTime = 60 * time.Second
+const MountsPath = "/proc/self/mounts"
+const FSMeasurementsName = "filesystem_stats"
+
+// FSTypeExcludePatterns selects the filesystem types that are not reported, by default pseudo filesystems
+// and network filesystems, whose statfs call blocks while the server is unreachable
+var FSTypeExcludePatterns = []string{"proc", "sysfs", "devtmpfs", "devpts", "tmpfs", "cgroup", "cgroup2",
+	"securityfs", "pstore", "debugfs", "tracefs", "configfs", "fusectl", "mqueue", "hugetlbfs", "bpf",
+	"autofs", "binfmt_misc", "rpc_pipefs", "nsfs", "overlay", "squashfs", "efivarfs", "nfs", "nfs4", "cifs"}
+
+// FSMountIncludePatterns selects the mount points to report, all of them are reported when empty
+var FSMountIncludePatterns = []string{}
+
+// FSMountExcludePatterns selects mount points that are never reported
+var FSMountExcludePatterns = []string{}
+
+// MountInfo contains one line of /proc/self/mounts
+type MountInfo struct {
+	Device     string
+	MountPoint string
+	FSType     string
+	ReadOnly   bool
+}
+
+// FSStats contains the space and inode usage of one mounted filesystem
+type FSStats struct {
+	Mount       MountInfo
+	Total       uint64 // bytes
+	Free        uint64 // bytes free, including those reserved to root
+	Available   uint64 // bytes available to unprivileged users
+	Used        uint64 // bytes
+	InodesTotal uint64
+	InodesFree  uint64
+	InodesUsed  uint64
+}
+
+func ReportFSStats(dbName, piName string, c client.Client) error {
+	log.Printf("ReportFSStats() is starting, %s\n", piName)
+
+	ticker := time.NewTicker(DefaultFSReportTime)
+	for {
+		select {
+		case t := <-ticker.C:
+			data, err := ioutil.ReadFile(MountsPath)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+
+			for _, mount := range getMounts(string(data)) {
+				stat, err := getFSStats(mount)
+				if err != nil {
+					log.Println(err)
+					continue
+				}
+
+				err = reportFSStatsToInflux(dbName, piName, stat, t, c)
+				if err != nil {
+					log.Println(err)
+				}
+			}
+		}
+	}
+}
+
+func getMounts(data string) []MountInfo {
+	// given the content of /proc/self/mounts, return the mount points that should be reported
+	// a mount point mounted more than once is only reported once
+	var output []MountInfo
+	seen := make(map[string]int)
+
+	for _, line := range strings.Split(data, "\n") {
+		list := strings.Fields(line)
+		if len(list) < 4 {
+			continue
+		}
+
+		mount := MountInfo{
+			Device:     unescapeMountField(list[0]),
+			MountPoint: unescapeMountField(list[1]),
+			FSType:     list[2],
+		}
+		for _, opt := range strings.Split(list[3], ",") {
+			if opt == "ro" {
+				mount.ReadOnly = true
+			}
+		}
+
+		if helper.MatchPatterns(FSTypeExcludePatterns, mount.FSType) ||
+			helper.MatchPatterns(FSMountExcludePatterns, mount.MountPoint) {
+			continue
+		}
+		if len(FSMountIncludePatterns) > 0 && !helper.MatchPatterns(FSMountIncludePatterns, mount.MountPoint) {
+			continue
+		}
+
+		if i, ok := seen[mount.MountPoint]; ok {
+			// the last mount hides the previous ones
+			output[i] = mount
+			continue
+		}
+		seen[mount.MountPoint] = len(output)
+		output = append(output, mount)
+	}
+
+	return output
+}
+
+func unescapeMountField(field string) string {
+	// spaces, tabs, newlines and backslashes are escaped as octal sequences, e.g. \040
+	if !strings.Contains(field, "\\") {
+		return field
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+3 < len(field) {
+			if val, err := strconv.ParseUint(field[i+1:i+4], 8, 8); err == nil {
+				sb.WriteByte(byte(val))
+				i += 3
+				continue
+			}
+		}
+		sb.WriteByte(field[i])
+	}
+
+	return sb.String()
+}
+
+func getFSStats(mount MountInfo) (FSStats, error) {
+	// get the usage of the filesystem mounted at mount.MountPoint, the same way df does
+	stats := FSStats{Mount: mount}
+
+	var buf syscall.Statfs_t
+	err := syscall.Statfs(mount.MountPoint, &buf)
+	if err != nil {
+		return stats, err
+	}
+
+	// block counts are in fragments, Bsize is only the preferred I/O size
+	blockSize := uint64(buf.Frsize)
+	stats.Total = uint64(buf.Blocks) * blockSize
+	stats.Free = uint64(buf.Bfree) * blockSize
+	stats.Available = uint64(buf.Bavail) * blockSize
+	stats.Used = stats.Total - stats.Free
+	stats.InodesTotal = uint64(buf.Files)
+	stats.InodesFree = uint64(buf.Ffree)
+	stats.InodesUsed = stats.InodesTotal - stats.InodesFree
+
+	return stats, nil
+}
+
+func reportFSStatsToInflux(dbName, piName string, stat FSStats, now time.Time, c client.Client) error {
+	tags := map[string]string{
+		"pi_name":     piName,
+		"mount_point": stat.Mount.MountPoint,
+		"device":      stat.Mount.Device,
+		"fs_type":     stat.Mount.FSType,
+	}
+	fields := map[string]interface{}{
+		"total":        int64(stat.Total),
+		"free":         int64(stat.Free),
+		"available":    int64(stat.Available),
+		"used":         int64(stat.Used),
+		"inodes_total": int64(stat.InodesTotal),
+		"inodes_free":  int64(stat.InodesFree),
+		"inodes_used":  int64(stat.InodesUsed),
+		"read_only":    stat.Mount.ReadOnly,
+	}
+
+	// percentage of the space usable by unprivileged users, like df
+	if stat.Used+stat.Available > 0 {
+		fields["used_percent"] = float64(stat.Used) / float64(stat.Used+stat.Available) * 100.0
+	}
+	if stat.InodesTotal > 0 {
+		fields["inodes_used_percent"] = float64(stat.InodesUsed) / float64(stat.InodesTotal) * 100.0
+	}
+
+	var dbInfoObj helper.DBInfo
+	dbInfoObj.DBName = dbName
+	dbInfoObj.MeasName = FSMeasurementsName
+	dbInfoObj.Tags = tags
+	dbInfoObj.Fields = fields
+	dbInfoObj.Now = now
+
+	err := helper.ReportStatsToInflux(dbInfoObj, c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
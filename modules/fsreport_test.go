@@ -0,0 +1,89 @@
+package modules
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func Test_getMounts(t *testing.T) {
+	data, err := ioutil.ReadFile("../TestFiles/mounts_sample.txt")
+	if err != nil {
+		t.Fatalf("Could not read sample file, %v\n", err)
+	}
+
+	var tests = []struct {
+		include []string
+		exclude []string
+		want    []MountInfo
+	}{
+		{[]string{}, []string{}, []MountInfo{
+			{"/dev/root", "/", "ext4", false},
+			{"/dev/mmcblk0p1", "/boot", "vfat", false},
+			{"/dev/sda1", "/mnt/usb drive", "ext4", false},
+			{"/dev/sdb1", "/var/lib/docker", "ext4", false}}},
+		{[]string{"/", "/mnt/*"}, []string{}, []MountInfo{
+			{"/dev/root", "/", "ext4", false},
+			{"/dev/sda1", "/mnt/usb drive", "ext4", false}}},
+		{[]string{}, []string{"re:^/(boot|var)"}, []MountInfo{
+			{"/dev/root", "/", "ext4", false},
+			{"/dev/sda1", "/mnt/usb drive", "ext4", false}}},
+	}
+
+	defer func() {
+		FSMountIncludePatterns = []string{}
+		FSMountExcludePatterns = []string{}
+	}()
+
+	for i, tt := range tests {
+		testname := fmt.Sprintf("%d", i)
+		t.Run(testname, func(t *testing.T) {
+			FSMountIncludePatterns = tt.include
+			FSMountExcludePatterns = tt.exclude
+
+			got := getMounts(string(data))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_unescapeMountField(t *testing.T) {
+	var tests = []struct {
+		field string
+		want  string
+	}{
+		{"/mnt/usb", "/mnt/usb"},
+		{"/mnt/usb\\040drive", "/mnt/usb drive"},
+		{"/mnt/a\\134b", "/mnt/a\\b"},
+		{"/mnt/bad\\04", "/mnt/bad\\04"},
+	}
+
+	for i, tt := range tests {
+		testname := fmt.Sprintf("%d", i)
+		t.Run(testname, func(t *testing.T) {
+			got := unescapeMountField(tt.field)
+			if got != tt.want {
+				t.Errorf("Got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getFSStats(t *testing.T) {
+	t.Run("Read root filesystem statistics", func(t *testing.T) {
+		got, err := getFSStats(MountInfo{MountPoint: "/"})
+
+		// check for error
+		if err != nil {
+			t.Errorf("Got error, %v\n", err)
+		}
+
+		// check for impossible values
+		if got.Total == 0 || got.Used > got.Total || got.Available > got.Free {
+			t.Errorf("Retrieved invalid filesystem stats, %+v\n", got)
+		}
+	})
+}
@@ -0,0 +1,316 @@
+package modules
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dpinato/pi-reporter/helper"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+const DefaultKmsgReportTime = 30 * time.Second
+const KmsgPath = "/dev/kmsg"
+const KmsgMeasurementsName = "kernel_log_stats"
+const KmsgEventsMeasurementsName = "kernel_log_events"
+
+// KmsgMaxEvents is the number of events reported for each pattern in a DefaultKmsgReportTime period,
+// further matches are only counted so that a flood of messages does not flood the database
+const KmsgMaxEvents = 10
+
+// KmsgMaxRecordSize is the size of the largest record returned by /dev/kmsg
+const KmsgMaxRecordSize = 8192
+
+// KmsgReopenDelay is the time waited before reopening /dev/kmsg after a read error
+const KmsgReopenDelay = 10 * time.Second
+
+// KmsgPatterns are the patterns matched against kernel messages, a counter is reported for each of them
+var KmsgPatterns = []KmsgPattern{
+	mustKmsgPattern("sd_card_error", `re:(?i)mmc\d+: .*(timeout|error)`),
+	mustKmsgPattern("fs_error", `re:(EXT4-fs|FAT-fs|F2FS-fs) .*error`),
+	mustKmsgPattern("io_error", `re:I/O error`),
+	mustKmsgPattern("under_voltage", `re:(?i)under-?voltage detected`),
+	mustKmsgPattern("oom_kill", `re:Out of memory: Killed process`),
+}
+
+// KmsgPattern names a pattern, a glob or a regular expression starting with helper.PatternRegexpPrefix
+// globs must match the whole message, unlike filepath.Match their * and ? also match /
+type KmsgPattern struct {
+	Name    string
+	Pattern string
+	regexp  *regexp.Regexp // compiled once by newKmsgPattern, messages are matched at a high rate
+}
+
+// KmsgRecord is one message of the kernel log
+// https://www.kernel.org/doc/Documentation/ABI/testing/dev-kmsg
+type KmsgRecord struct {
+	Level     int // syslog level, 0 (emerg) to 7 (debug)
+	Seq       int64
+	Timestamp time.Duration // since boot
+	Message   string
+}
+
+// ParseKmsgPatterns parses a list of patterns like under_voltage=re:Under-voltage
+func ParseKmsgPatterns(patterns []string) ([]KmsgPattern, error) {
+	var output []KmsgPattern
+	for _, elem := range patterns {
+		pos := strings.Index(elem, "=")
+		if pos < 1 || pos == len(elem)-1 {
+			return nil, fmt.Errorf("bad kernel log pattern %s, expected <name>=<pattern>", elem)
+		}
+		pattern, err := newKmsgPattern(elem[0:pos], elem[pos+1:])
+		if err != nil {
+			return nil, fmt.Errorf("bad kernel log pattern %s, %v", elem, err)
+		}
+		output = append(output, pattern)
+	}
+
+	return output, nil
+}
+
+func newKmsgPattern(name, pattern string) (KmsgPattern, error) {
+	// kernel messages are free text, so a glob is turned into a regular expression where * matches
+	// any character, e.g. *throttl* matches cpu/cpufreq: throttled
+	expr := strings.TrimPrefix(pattern, helper.PatternRegexpPrefix)
+	if !strings.HasPrefix(pattern, helper.PatternRegexpPrefix) {
+		var b strings.Builder
+		b.WriteString("^")
+		for _, r := range pattern {
+			switch r {
+			case '*':
+				b.WriteString(".*")
+			case '?':
+				b.WriteString(".")
+			default:
+				b.WriteString(regexp.QuoteMeta(string(r)))
+			}
+		}
+		b.WriteString("$")
+		expr = b.String()
+	}
+
+	r, err := regexp.Compile(expr)
+	if err != nil {
+		return KmsgPattern{}, err
+	}
+	return KmsgPattern{Name: name, Pattern: pattern, regexp: r}, nil
+}
+
+func mustKmsgPattern(name, pattern string) KmsgPattern {
+	p, err := newKmsgPattern(name, pattern)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func ReportKmsgStats(dbName, piName string, c client.Client) error {
+	f, err := openKmsg()
+	if err != nil {
+		log.Printf("ReportKmsgStats() is disabled, %v\n", err)
+		return err
+	}
+
+	log.Printf("ReportKmsgStats() is starting, %s\n", piName)
+
+	records := make(chan KmsgRecord, 100)
+	go func() {
+		// /dev/kmsg does not end, reopen it after a read error so that the collector does not stop
+		// silently; messages logged until it is open again are missed
+		for {
+			err := watchKmsg(f, records)
+			f.Close()
+			if err == nil {
+				err = io.EOF
+			}
+			log.Printf("Failed to read %s, reopening it, %v\n", KmsgPath, err)
+
+			for {
+				time.Sleep(KmsgReopenDelay)
+				f, err = openKmsg()
+				if err == nil {
+					break
+				}
+				log.Println(err)
+			}
+		}
+	}()
+
+	// counters are cumulative since pi-reporter started
+	counts := make(map[string]int64)
+	events := make(map[string]int)
+	for _, elem := range KmsgPatterns {
+		counts[elem.Name] = 0
+	}
+
+	ticker := time.NewTicker(DefaultKmsgReportTime)
+	for {
+		select {
+		case record := <-records:
+			now := time.Now()
+			for _, name := range matchKmsgRecord(KmsgPatterns, record) {
+				counts[name]++
+				events[name]++
+				if events[name] > KmsgMaxEvents {
+					continue
+				}
+
+				err = reportKmsgEventToInflux(dbName, piName, name, record, now, c)
+				if err != nil {
+					log.Println(err)
+				}
+			}
+
+		case t := <-ticker.C:
+			err = reportKmsgStatsToInflux(dbName, piName, counts, t, c)
+			if err != nil {
+				log.Println(err)
+			}
+			events = make(map[string]int)
+		}
+	}
+}
+
+func openKmsg() (*os.File, error) {
+	// only messages logged from now on are reported, the ones already in the buffer are skipped
+	f, err := os.Open(KmsgPath)
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func watchKmsg(r io.Reader, records chan<- KmsgRecord) error {
+	// send the records read from r, /dev/kmsg returns one record per read and blocks when there
+	// are no new ones, other files end with io.EOF
+	// a read smaller than the record fails with EINVAL, so the buffer fits the largest record
+	reader := bufio.NewReaderSize(r, KmsgMaxRecordSize)
+	for {
+		line, err := reader.ReadString('\n')
+		if errors.Is(err, syscall.EPIPE) {
+			// records were overwritten before being read, carry on with the next one
+			log.Println("Some kernel messages were lost")
+			continue
+		}
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		record, ok := parseKmsgRecord(line)
+		if ok {
+			records <- record
+		}
+	}
+}
+
+func parseKmsgRecord(line string) (KmsgRecord, bool) {
+	// a record is a header, a semicolon and the message, lines starting with a space continue the
+	// previous record with key=value pairs and are skipped
+	// 3,1234,5678901,-;mmc0: Timeout waiting for hardware interrupt.
+	var record KmsgRecord
+	pos := strings.Index(line, ";")
+	if strings.HasPrefix(line, " ") || pos == -1 {
+		return record, false
+	}
+
+	list := strings.Split(line[0:pos], ",")
+	if len(list) < 3 {
+		return record, false
+	}
+	prefix, err := strconv.Atoi(list[0])
+	if err != nil {
+		return record, false
+	}
+	record.Level = prefix & 7 // the facility is in the upper bits
+	record.Seq, _ = strconv.ParseInt(list[1], 10, 64)
+	usec, _ := strconv.ParseInt(list[2], 10, 64)
+	record.Timestamp = time.Duration(usec) * time.Microsecond
+	record.Message = strings.TrimRight(line[pos+1:], "\n")
+
+	return record, true
+}
+
+func matchKmsgRecord(patterns []KmsgPattern, record KmsgRecord) []string {
+	// return the names of the patterns matching the message, a name may be used by several patterns
+	var output []string
+	for _, elem := range patterns {
+		if !elem.regexp.MatchString(record.Message) {
+			continue
+		}
+
+		found := false
+		for _, name := range output {
+			found = found || name == elem.Name
+		}
+		if !found {
+			output = append(output, elem.Name)
+		}
+	}
+
+	return output
+}
+
+func reportKmsgStatsToInflux(dbName, piName string, counts map[string]int64, now time.Time, c client.Client) error {
+	tags := map[string]string{
+		"pi_name": piName,
+	}
+	fields := map[string]interface{}{}
+	for k, v := range counts {
+		fields[k] = v
+	}
+
+	var dbInfoObj helper.DBInfo
+	dbInfoObj.DBName = dbName
+	dbInfoObj.MeasName = KmsgMeasurementsName
+	dbInfoObj.Tags = tags
+	dbInfoObj.Fields = fields
+	dbInfoObj.Now = now
+
+	err := helper.ReportStatsToInflux(dbInfoObj, c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func reportKmsgEventToInflux(dbName, piName, pattern string, record KmsgRecord, now time.Time, c client.Client) error {
+	tags := map[string]string{
+		"pi_name": piName,
+		"pattern": pattern,
+	}
+	fields := map[string]interface{}{
+		"message":         record.Message,
+		"level":           record.Level,
+		"seq":             record.Seq,
+		"kernel_time_sec": record.Timestamp.Seconds(),
+	}
+
+	var dbInfoObj helper.DBInfo
+	dbInfoObj.DBName = dbName
+	dbInfoObj.MeasName = KmsgEventsMeasurementsName
+	dbInfoObj.Tags = tags
+	dbInfoObj.Fields = fields
+	dbInfoObj.Now = now
+
+	err := helper.ReportStatsToInflux(dbInfoObj, c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
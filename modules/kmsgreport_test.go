@@ -0,0 +1,122 @@
+package modules
+
+import (
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func Test_watchKmsg(t *testing.T) {
+	f, err := os.Open("../TestFiles/kmsg_sample.txt")
+	if err != nil {
+		t.Fatalf("Could not open sample, %v\n", err)
+	}
+	defer f.Close()
+
+	records := make(chan KmsgRecord, 100)
+	err = watchKmsg(f, records)
+	if err != nil {
+		t.Fatalf("Got error, %v\n", err)
+	}
+	close(records)
+
+	counts := make(map[string]int)
+	var got []KmsgRecord
+	for record := range records {
+		got = append(got, record)
+		for _, name := range matchKmsgRecord(KmsgPatterns, record) {
+			counts[name]++
+		}
+	}
+
+	// the continuation lines of the mmc record are skipped
+	if len(got) != 8 {
+		t.Fatalf("Got %d records, want 8", len(got))
+	}
+	wantRecord := KmsgRecord{Level: 3, Seq: 1022, Timestamp: 5238921 * time.Microsecond,
+		Message: "mmc0: Timeout waiting for hardware interrupt."}
+	if !reflect.DeepEqual(got[1], wantRecord) {
+		t.Errorf("Got %+v, want %+v", got[1], wantRecord)
+	}
+
+	wantCounts := map[string]int{"sd_card_error": 2, "fs_error": 1, "under_voltage": 2, "oom_kill": 1}
+	if !reflect.DeepEqual(counts, wantCounts) {
+		t.Errorf("Got %v, want %v", counts, wantCounts)
+	}
+}
+
+func Test_watchKmsgError(t *testing.T) {
+	// a read error other than EPIPE is returned, so that the caller can reopen /dev/kmsg
+	readErr := errors.New("read failed")
+	r := io.MultiReader(strings.NewReader("6,1,0,-;first\n"), iotest.ErrReader(readErr))
+
+	records := make(chan KmsgRecord, 10)
+	err := watchKmsg(r, records)
+	if err != readErr {
+		t.Errorf("Got error %v, want %v", err, readErr)
+	}
+	if len(records) != 1 {
+		t.Errorf("Got %d records, want 1", len(records))
+	}
+}
+
+func Test_parseKmsgRecord(t *testing.T) {
+	var tests = []struct {
+		line string
+		want KmsgRecord
+		ok   bool
+	}{
+		{"14,1028,9000000,-;systemd[1]: Started Session 3 of user pi.\n",
+			KmsgRecord{6, 1028, 9 * time.Second, "systemd[1]: Started Session 3 of user pi."}, true},
+		{"6,1,0,-;a; b", KmsgRecord{6, 1, 0, "a; b"}, true},
+		{" SUBSYSTEM=mmc\n", KmsgRecord{}, false},
+		{"no header\n", KmsgRecord{}, false},
+		{"x,1,0,-;message\n", KmsgRecord{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.TrimSpace(tt.line), func(t *testing.T) {
+			got, ok := parseKmsgRecord(tt.line)
+			if ok != tt.ok || (ok && !reflect.DeepEqual(got, tt.want)) {
+				t.Errorf("Got %+v %v, want %+v %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func Test_ParseKmsgPatterns(t *testing.T) {
+	got, err := ParseKmsgPatterns([]string{"usb_reset=re:usb .*reset", "throttle=*throttl*"})
+	if err != nil {
+		t.Fatalf("Got error, %v\n", err)
+	}
+	if len(got) != 2 || got[0].Name != "usb_reset" || got[1].Name != "throttle" || got[1].Pattern != "*throttl*" {
+		t.Fatalf("Got %+v, want usb_reset and throttle", got)
+	}
+
+	// globs span the whole message, including slashes
+	var tests = []struct {
+		message string
+		want    []string
+	}{
+		{"usb 1-1.2: reset high-speed USB device number 3 using dwc_otg", []string{"usb_reset"}},
+		{"cpu/cpufreq: CPU0 throttled", []string{"throttle"}},
+		{"usb 1-1.2: new device found", nil},
+	}
+	for _, tt := range tests {
+		matched := matchKmsgRecord(got, KmsgRecord{Message: tt.message})
+		if !reflect.DeepEqual(matched, tt.want) {
+			t.Errorf("Got %v for %s, want %v", matched, tt.message, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"usb_reset", "=re:usb", "usb_reset=", "usb_reset=re:usb (reset"} {
+		if _, err := ParseKmsgPatterns([]string{bad}); err == nil {
+			t.Errorf("Got no error for %s", bad)
+		}
+	}
+}
@@ -3,7 +3,6 @@ package modules
 import (
 	"io/ioutil"
 	"log"
-	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -16,17 +15,8 @@ const DefaultMemoryReportTime = 30 * time.Second
 const MemoryStatsPath = "/proc/meminfo"
 const MemoryMeasurementsName = "memory_stats"
 
-func ReportMemoryStats(dbName string, c client.Client) error {
-	myName, _ := helper.GetPIName(helper.PINetIfaces[0])
-	hostname, err := os.Hostname()
-	if err != nil {
-		log.Printf("Failed to get hostname - %+v", err)
-		hostname = myName
-	} else if hostname == helper.PIDefaultHostname {
-		hostname = myName
-	}
-
-	log.Printf("ReportMemoryStats() is starting, %s\n", hostname)
+func ReportMemoryStats(dbName, piName string, c client.Client) error {
+	log.Printf("ReportMemoryStats() is starting, %s\n", piName)
 
 	ticker := time.NewTicker(DefaultMemoryReportTime)
 	for {
@@ -38,7 +28,7 @@ func ReportMemoryStats(dbName string, c client.Client) error {
 				continue
 			}
 
-			err = reportMemoryStatsToInflux(dbName, hostname, stat, t, c)
+			err = reportMemoryStatsToInflux(dbName, piName, stat, t, c)
 			if err != nil {
 				log.Println(err)
 			}
@@ -46,16 +36,16 @@ func ReportMemoryStats(dbName string, c client.Client) error {
 	}
 }
 
-func getMemoryStats() (map[string]int, error) {
+func getMemoryStats() (map[string]int64, error) {
 	// /proc/meminfo has a lot of statistics (many of them aren't always useful)
 	// we might as well get all of them
 	data, err := ioutil.ReadFile(MemoryStatsPath)
 	if err != nil {
-		return map[string]int{}, err
+		return map[string]int64{}, err
 	}
 	stringList := strings.Split(string(data), "\n")
 
-	var memStats = make(map[string]int)
+	var memStats = make(map[string]int64)
 	for _, line := range stringList {
 		if len(line) == 0 {
 			continue
@@ -76,8 +66,9 @@ func getMemoryStats() (map[string]int, error) {
 	return memStats, nil
 }
 
-func getMemoryStatFromLine(line string) (string, int) {
-	// given a line from /proc/meminfo, return string containing the stat name and its value
+func getMemoryStatFromLine(line string) (string, int64) {
+	// given a line from /proc/meminfo, return string containing the stat name and its value in bytes
+	// most lines are in kB, a few like HugePages_Total are counts without a unit
 	// get field name
 	pos := strings.Index(line, ":")
 	if pos == -1 {
@@ -86,21 +77,64 @@ func getMemoryStatFromLine(line string) (string, int) {
 	field := line[0:pos]
 
 	// get value
-	pos = strings.LastIndex(line[0:len(line)-3], " ")
-	if pos == -1 {
+	list := strings.Fields(line[pos+1:])
+	if len(list) == 0 || len(list) > 2 {
 		return field, -1
 	}
-	tmpValue := line[pos+1 : len(line)-3]
-	tmpValueInt, err := strconv.ParseInt(tmpValue, 10, 32)
+	tmpValueInt, err := strconv.ParseInt(list[0], 10, 64)
 	if err != nil {
 		log.Printf("Could not parse value in line %s\n%v", line, err)
 		return field, -1
 	}
 
-	return field, int(tmpValueInt)
+	if len(list) == 2 {
+		if list[1] != "kB" {
+			log.Printf("Unknown unit in line %s\n", line)
+			return field, -1
+		}
+		tmpValueInt *= 1024
+	}
+
+	return field, tmpValueInt
+}
+
+func getDerivedMemoryStats(stat map[string]int64) map[string]interface{} {
+	// compute the same values shown by free(1) from procps-ng
+	output := map[string]interface{}{}
+
+	total := stat["MemTotal"]
+	buffCache := stat["Buffers"] + stat["Cached"] + stat["SReclaimable"]
+	output["buff_cache"] = buffCache
+
+	available, ok := stat["MemAvailable"]
+	if !ok {
+		// kernels older than 3.14 do not have MemAvailable
+		available = stat["MemFree"] + buffCache
+	}
+	used := total - available
+	if used < 0 {
+		used = total - stat["MemFree"]
+	}
+	output["used"] = used
+
+	if total > 0 {
+		output["used_percent"] = float64(used) / float64(total) * 100.0
+		output["available_percent"] = float64(available) / float64(total) * 100.0
+	}
+
+	swapTotal := stat["SwapTotal"]
+	swapUsed := swapTotal - stat["SwapFree"]
+	output["swap_used"] = swapUsed
+	if swapTotal > 0 {
+		output["swap_used_percent"] = float64(swapUsed) / float64(swapTotal) * 100.0
+	} else {
+		output["swap_used_percent"] = 0.0
+	}
+
+	return output
 }
 
-func reportMemoryStatsToInflux(dbName, piName string, stat map[string]int, now time.Time, c client.Client) error {
+func reportMemoryStatsToInflux(dbName, piName string, stat map[string]int64, now time.Time, c client.Client) error {
 	tags := map[string]string{
 		"pi_name": piName,
 	}
@@ -109,6 +143,9 @@ func reportMemoryStatsToInflux(dbName, piName string, stat map[string]int, now t
 	for k, v := range stat {
 		fields[k] = v
 	}
+	for k, v := range getDerivedMemoryStats(stat) {
+		fields[k] = v
+	}
 
 	var dbInfoObj helper.DBInfo
 	dbInfoObj.DBName = dbName
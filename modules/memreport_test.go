@@ -2,6 +2,7 @@ package modules
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 )
 
@@ -27,11 +28,13 @@ func Test_getMemoryStatFromLine(t *testing.T) {
 	var tests = []struct {
 		sampleLine string
 		wantField  string
-		wantValue  int
+		wantValue  int64
 	}{
-		{"MemTotal:         992964 kB", "MemTotal", 992964},
+		{"MemTotal:         992964 kB", "MemTotal", 992964 * 1024},
 		{"Writeback:             0 kB", "Writeback", 0},
-		{"CmaFree:            5952 kB", "CmaFree", 5952},
+		{"CmaFree:            5952 kB", "CmaFree", 5952 * 1024},
+		{"VmallocTotal:   34359738367 kB", "VmallocTotal", 34359738367 * 1024},
+		{"HugePages_Total:       4", "HugePages_Total", 4},
 		{"TestBadLine", "", -1},
 		{"TestBadLine2:", "TestBadLine2", -1},
 		{"TestBadLine3:         ", "TestBadLine3", -1},
@@ -50,3 +53,29 @@ func Test_getMemoryStatFromLine(t *testing.T) {
 		})
 	}
 }
+
+func Test_getDerivedMemoryStats(t *testing.T) {
+	var tests = []struct {
+		stat map[string]int64
+		want map[string]interface{}
+	}{
+		{map[string]int64{"MemTotal": 1000, "MemFree": 100, "MemAvailable": 600, "Buffers": 50, "Cached": 300,
+			"SReclaimable": 50, "SwapTotal": 400, "SwapFree": 300},
+			map[string]interface{}{"buff_cache": int64(400), "used": int64(400), "used_percent": 40.0,
+				"available_percent": 60.0, "swap_used": int64(100), "swap_used_percent": 25.0}},
+		// no MemAvailable and no swap
+		{map[string]int64{"MemTotal": 1000, "MemFree": 100, "Buffers": 50, "Cached": 300, "SReclaimable": 50},
+			map[string]interface{}{"buff_cache": int64(400), "used": int64(500), "used_percent": 50.0,
+				"available_percent": 50.0, "swap_used": int64(0), "swap_used_percent": 0.0}},
+	}
+
+	for i, tt := range tests {
+		testname := fmt.Sprintf("%d", i)
+		t.Run(testname, func(t *testing.T) {
+			got := getDerivedMemoryStats(tt.stat)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package modules
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dpinato/pi-reporter/helper"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+const DefaultMMCReportTime = 60 * time.Second
+const BaseBlockDir = "/sys/block/"
+const BootIDPath = "/proc/sys/kernel/random/boot_id"
+const MMCMeasurementsName = "mmc_health"
+
+// MMCStateSaveInterval is how often the bytes written are saved, the file lives on the card itself
+// so saving it on every sample would add to the wear; it is also saved when pi-reporter is stopped,
+// writes between the last save and a power cut are lost
+const MMCStateSaveInterval = time.Hour
+
+// MMCStateFile keeps the bytes written to each card across restarts
+var MMCStateFile = "/var/lib/pi-reporter/mmc_state.json"
+
+// mmcDeviceName matches SD cards and eMMC devices, but not the boot and rpmb partitions of eMMC
+var mmcDeviceName = regexp.MustCompile(`^mmcblk\d+$`)
+
+// MMCInfo contains the identity and health of one SD card or eMMC device
+// https://www.kernel.org/doc/Documentation/mmc/mmc-dev-attrs.txt
+type MMCInfo struct {
+	Device       string // e.g. mmcblk0
+	CardID       string // the CID register, or the manufacturer and serial when it is not exposed, empty when neither is
+	Type         string // SD or MMC
+	Name         string
+	ManfID       string
+	OEMID        string
+	Date         string // manufacturing date, e.g. 07/2021
+	Serial       string
+	LifeTimeA    int64 // eMMC only, estimated wear in steps of 10%, 11 when exceeded, -1 when not exposed
+	LifeTimeB    int64
+	PreEOLInfo   int64 // eMMC only, 1 normal, 2 warning, 3 urgent, -1 when not exposed
+	WriteSectors int64 // sectors written since boot
+}
+
+// MMCWearState is the persisted state of one card
+type MMCWearState struct {
+	BootID       string
+	LastSectors  int64 // sectors written since boot at the last sample
+	BytesWritten int64 // since FirstSeen
+	FirstSeen    time.Time
+}
+
+func ReportMMCStats(dbName, piName string, c client.Client) error {
+	devices, err := getMMCDevices(BaseBlockDir)
+	if err == nil && len(devices) == 0 {
+		err = errors.New("no SD card or eMMC found")
+	}
+	if err != nil {
+		log.Printf("ReportMMCStats() is disabled, %v\n", err)
+		return err
+	}
+
+	log.Printf("ReportMMCStats() is starting, %s\n", piName)
+
+	bootID := readSysfsString(BootIDPath)
+	state, err := loadMMCState(MMCStateFile)
+	if err != nil {
+		log.Printf("Could not load %s, bytes written are counted from now, %v\n", MMCStateFile, err)
+		state = make(map[string]MMCWearState)
+	}
+	lastSave := time.Now()
+	unidentified := make(map[string]MMCWearState)
+
+	// the state is also saved when pi-reporter is stopped, while a sample may be updating it
+	var mutex sync.Mutex
+	helper.OnShutdown(func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		err := saveMMCState(MMCStateFile, state)
+		if err != nil {
+			log.Println(err)
+		}
+	})
+
+	ticker := time.NewTicker(DefaultMMCReportTime)
+	for {
+		select {
+		case t := <-ticker.C:
+			// new cards are saved straight away, so their first sighting survives a restart
+			saveNow := t.Sub(lastSave) >= MMCStateSaveInterval
+			for _, device := range devices {
+				info, err := getMMCInfo(filepath.Join(BaseBlockDir, device))
+				if err != nil {
+					log.Println(err)
+					continue
+				}
+
+				if info.CardID == "" {
+					// a card without an identity cannot be told apart from the next one in the slot,
+					// so its bytes written are only counted while pi-reporter runs
+					wear := updateMMCWear(unidentified[info.Device], bootID, info.WriteSectors, t)
+					unidentified[info.Device] = wear
+					err = reportMMCStatsToInflux(dbName, piName, info, wear, t, c)
+					if err != nil {
+						log.Println(err)
+					}
+					continue
+				}
+
+				mutex.Lock()
+				prev, ok := state[info.CardID]
+				saveNow = saveNow || !ok
+				wear := updateMMCWear(prev, bootID, info.WriteSectors, t)
+				state[info.CardID] = wear
+				mutex.Unlock()
+				err = reportMMCStatsToInflux(dbName, piName, info, wear, t, c)
+				if err != nil {
+					log.Println(err)
+				}
+			}
+
+			if saveNow {
+				mutex.Lock()
+				err = saveMMCState(MMCStateFile, state)
+				mutex.Unlock()
+				if err != nil {
+					log.Println(err)
+				}
+				lastSave = t
+			}
+		}
+	}
+}
+
+func getMMCDevices(baseDir string) ([]string, error) {
+	// return the SD cards and eMMC devices in baseDir, normally /sys/block/
+	entries, err := ioutil.ReadDir(baseDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var output []string
+	for _, elem := range entries {
+		if mmcDeviceName.MatchString(elem.Name()) {
+			output = append(output, elem.Name())
+		}
+	}
+
+	return output, nil
+}
+
+func getMMCInfo(devDir string) (MMCInfo, error) {
+	// read the attributes of the card in devDir/device/ and the sectors written from devDir/stat
+	// attributes that are not exposed by the card or the driver are left empty
+	info := MMCInfo{Device: filepath.Base(devDir), LifeTimeA: -1, LifeTimeB: -1, PreEOLInfo: -1}
+
+	data, err := ioutil.ReadFile(filepath.Join(devDir, "stat"))
+	if err != nil {
+		return info, err
+	}
+	// the seventh field is the number of sectors written
+	// https://www.kernel.org/doc/Documentation/block/stat.txt
+	list := strings.Fields(string(data))
+	if len(list) > 6 {
+		info.WriteSectors, _ = strconv.ParseInt(list[6], 10, 64)
+	}
+
+	cardDir := filepath.Join(devDir, "device")
+	info.Type = readSysfsString(filepath.Join(cardDir, "type"))
+	info.Name = readSysfsString(filepath.Join(cardDir, "name"))
+	info.ManfID = readSysfsString(filepath.Join(cardDir, "manfid"))
+	info.OEMID = readSysfsString(filepath.Join(cardDir, "oemid"))
+	info.Date = readSysfsString(filepath.Join(cardDir, "date"))
+	info.Serial = readSysfsString(filepath.Join(cardDir, "serial"))
+
+	info.CardID = readSysfsString(filepath.Join(cardDir, "cid"))
+	if info.CardID == "" && info.ManfID != "" && info.Serial != "" {
+		info.CardID = info.ManfID + "-" + info.Serial
+	}
+
+	// life_time has two hex values, for type A and type B memory, e.g. 0x01 0x02
+	lifeTime := strings.Fields(readSysfsString(filepath.Join(cardDir, "life_time")))
+	if len(lifeTime) == 2 {
+		info.LifeTimeA = parseMMCHex(lifeTime[0])
+		info.LifeTimeB = parseMMCHex(lifeTime[1])
+	}
+	if preEOL := readSysfsString(filepath.Join(cardDir, "pre_eol_info")); preEOL != "" {
+		info.PreEOLInfo = parseMMCHex(preEOL)
+	}
+
+	return info, nil
+}
+
+func parseMMCHex(value string) int64 {
+	v, err := strconv.ParseInt(strings.TrimPrefix(value, "0x"), 16, 64)
+	if err != nil {
+		return -1
+	}
+	return v
+}
+
+func updateMMCWear(wear MMCWearState, bootID string, sectors int64, now time.Time) MMCWearState {
+	// add the sectors written since the last sample, sectors are counted from boot so after a reboot
+	// all the sectors written since boot are new; a new card starts from the sectors written so far
+	if wear.FirstSeen.IsZero() {
+		wear.FirstSeen = now
+		wear.BootID = bootID
+		wear.LastSectors = sectors
+		return wear
+	}
+
+	delta := sectors
+	if wear.BootID == bootID {
+		// the counter wraps at 32 bits on 32 bit kernels, one that was reset counts again from zero
+		if d, ok := counterDelta(wear.LastSectors, sectors); ok {
+			delta = d
+		}
+	}
+	wear.BytesWritten += delta * DiskSectorSize
+	wear.BootID = bootID
+	wear.LastSectors = sectors
+
+	return wear
+}
+
+func loadMMCState(path string) (map[string]MMCWearState, error) {
+	// a missing file is an empty state, e.g. on the first run
+	state := make(map[string]MMCWearState)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func saveMMCState(path string, state map[string]MMCWearState) error {
+	// write to a temporary file first, so a power cut does not leave a truncated state
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	err = ioutil.WriteFile(tmpPath, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func reportMMCStatsToInflux(dbName, piName string, info MMCInfo, wear MMCWearState, now time.Time, c client.Client) error {
+	tags := map[string]string{
+		"pi_name": piName,
+		"device":  info.Device,
+		"serial":  info.Serial,
+	}
+	fields := map[string]interface{}{
+		"type":                     info.Type,
+		"name":                     info.Name,
+		"manfid":                   info.ManfID,
+		"oemid":                    info.OEMID,
+		"date":                     info.Date,
+		"bytes_written_since_boot": info.WriteSectors * DiskSectorSize,
+		"bytes_written_total":      wear.BytesWritten,
+		"first_seen":               wear.FirstSeen.Unix(),
+	}
+	if info.LifeTimeA >= 0 {
+		fields["life_time_a"] = info.LifeTimeA
+		fields["life_time_b"] = info.LifeTimeB
+	}
+	if info.PreEOLInfo >= 0 {
+		fields["pre_eol_info"] = info.PreEOLInfo
+	}
+
+	var dbInfoObj helper.DBInfo
+	dbInfoObj.DBName = dbName
+	dbInfoObj.MeasName = MMCMeasurementsName
+	dbInfoObj.Tags = tags
+	dbInfoObj.Fields = fields
+	dbInfoObj.Now = now
+
+	err := helper.ReportStatsToInflux(dbInfoObj, c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package modules
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_getMMCInfo(t *testing.T) {
+	devices, err := getMMCDevices("../TestFiles/sys/block/")
+	if err != nil {
+		t.Fatalf("Got error, %v\n", err)
+	}
+	if want := []string{"mmcblk0", "mmcblk1", "mmcblk2"}; !reflect.DeepEqual(devices, want) {
+		t.Errorf("Got %v, want %v", devices, want)
+	}
+
+	var tests = []struct {
+		device string
+		want   MMCInfo
+	}{
+		{"mmcblk0", MMCInfo{Device: "mmcblk0", CardID: "150100384754463452021c4a1b2e6b01", Type: "MMC",
+			Name: "8GTF4R", ManfID: "0x000015", OEMID: "0x0100", Date: "06/2020", Serial: "0x5c4a1b2e",
+			LifeTimeA: 2, LifeTimeB: 1, PreEOLInfo: 1, WriteSectors: 7340032}},
+		{"mmcblk1", MMCInfo{Device: "mmcblk1", CardID: "0x000003-0x8a3b2c1d", Type: "SD",
+			Name: "SC32G", ManfID: "0x000003", OEMID: "0x5344", Date: "07/2021", Serial: "0x8a3b2c1d",
+			LifeTimeA: -1, LifeTimeB: -1, PreEOLInfo: -1, WriteSectors: 16384}},
+		// no CID, manufacturer or serial, the card has no identity to keep its state under
+		{"mmcblk2", MMCInfo{Device: "mmcblk2", CardID: "", Type: "SD",
+			LifeTimeA: -1, LifeTimeB: -1, PreEOLInfo: -1, WriteSectors: 80}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.device, func(t *testing.T) {
+			got, err := getMMCInfo(filepath.Join("../TestFiles/sys/block/", tt.device))
+			if err != nil {
+				t.Fatalf("Got error, %v\n", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_updateMMCWear(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+
+	// a new card starts from the sectors written so far
+	wear := updateMMCWear(MMCWearState{}, "boot-1", 1000, now)
+	want := MMCWearState{BootID: "boot-1", LastSectors: 1000, BytesWritten: 0, FirstSeen: now}
+	if wear != want {
+		t.Errorf("Got %+v, want %+v", wear, want)
+	}
+
+	wear = updateMMCWear(wear, "boot-1", 3000, now.Add(time.Minute))
+	if wear.BytesWritten != 2000*DiskSectorSize {
+		t.Errorf("Got %d bytes written, want %d", wear.BytesWritten, 2000*DiskSectorSize)
+	}
+
+	// after a reboot all the sectors written since boot are new, even if more than before the reboot
+	wear = updateMMCWear(wear, "boot-2", 5000, now.Add(time.Hour))
+	if wear.BytesWritten != 7000*DiskSectorSize || wear.LastSectors != 5000 || !wear.FirstSeen.Equal(now) {
+		t.Errorf("Got %+v after a reboot", wear)
+	}
+
+	// the counter wraps at 32 bits on 32 bit kernels, only the sectors around the wrap are new
+	wear.LastSectors = math.MaxUint32 - 99
+	wear = updateMMCWear(wear, "boot-2", 100, now.Add(2*time.Hour))
+	if wear.BytesWritten != 7200*DiskSectorSize || wear.LastSectors != 100 {
+		t.Errorf("Got %+v after a wrap", wear)
+	}
+}
+
+func Test_MMCState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mmc")
+	if err != nil {
+		t.Fatalf("Could not create directory, %v\n", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state", "mmc_state.json")
+
+	state, err := loadMMCState(path)
+	if err != nil || len(state) != 0 {
+		t.Fatalf("Got %v and error %v for a missing file, want an empty state", state, err)
+	}
+
+	state["card"] = MMCWearState{BootID: "boot-1", LastSectors: 10, BytesWritten: 5120, FirstSeen: time.Unix(1600000000, 0)}
+	err = saveMMCState(path, state)
+	if err != nil {
+		t.Fatalf("Got error, %v\n", err)
+	}
+
+	got, err := loadMMCState(path)
+	if err != nil {
+		t.Fatalf("Got error, %v\n", err)
+	}
+	if len(got) != 1 || got["card"].BytesWritten != 5120 || !got["card"].FirstSeen.Equal(state["card"].FirstSeen) {
+		t.Errorf("Got %+v, want %+v", got, state)
+	}
+}
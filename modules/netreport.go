@@ -4,6 +4,7 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -16,6 +17,19 @@ const DefaultNetReportTime = 30 * time.Second
 const BaseNetStatsDir = "/sys/class/net/"
 const NetMeasurementsName = "network_stats"
 
+// ARPHRDLoopback is the value of /sys/class/net/<iface>/type for loopback interfaces
+const ARPHRDLoopback = "772"
+
+// NetIfIncludePatterns selects the interfaces to report, all physical interfaces are reported when empty;
+// interfaces matching one of these patterns explicitly are reported even if they are virtual
+var NetIfIncludePatterns = []string{}
+
+// NetIfExcludePatterns selects interfaces that are never reported
+var NetIfExcludePatterns = []string{}
+
+// NetIfIncludeVirtual reports virtual interfaces (bridges, VLANs, tunnels, ...) without an explicit include pattern
+var NetIfIncludeVirtual = false
+
 var NetStatsList = []string{"collisions", "rx_crc_errors", "rx_frame_errors", "rx_over_errors", "tx_carrier_errors",
 	"tx_fifo_errors", "multicast", "rx_dropped", "rx_length_errors", "rx_packets",
 	"tx_compressed", "tx_heartbeat_errors", "rx_bytes", "rx_errors", "rx_missed_errors",
@@ -24,33 +38,70 @@ var NetStatsList = []string{"collisions", "rx_crc_errors", "rx_frame_errors", "r
 
 type NetIFStats struct {
 	IfName     string
-	Speed      int64
+	Speed      int64 // link speed (Mbit/s), not available on wireless interfaces
 	Statistics map[string]int64
 }
 
-func ReportNetworkStats(dbName string, c client.Client) error {
-	myName, _ := helper.GetPIName(helper.PINetIfaces[0])
-	hostname, err := os.Hostname()
-	if err != nil {
-		log.Printf("Failed to get hostname - %+v", err)
-		hostname = myName
-	} else if hostname == helper.PIDefaultHostname {
-		hostname = myName
-	}
+// NetIFRates contains the rates computed between two consecutive NetIFStats samples of the same interface
+type NetIFRates struct {
+	IfName          string
+	RxBitsPerSec    float64
+	TxBitsPerSec    float64
+	RxPacketsPerSec float64
+	TxPacketsPerSec float64
+	RxErrorsPerSec  float64
+	TxErrorsPerSec  float64
+	RxDroppedPerSec float64
+	TxDroppedPerSec float64
+	RxErrorRatio    float64 // errors over packets received in the period
+	TxErrorRatio    float64
+	RxDropRatio     float64
+	TxDropRatio     float64
+	RxUtilisation   float64 // percentage of the link speed, only when the speed is known
+	TxUtilisation   float64
+}
+
+func ReportNetworkStats(dbName, piName string, c client.Client) error {
+	log.Printf("ReportNetworkStats() is starting, %s\n", piName)
 
-	log.Printf("ReportNetworkStats() is starting, %s\n", hostname)
+	// rates are computed against the previous sample of each interface
+	prevStats := make(map[string]NetIFStats)
+	prevTime := make(map[string]time.Time)
 
 	ticker := time.NewTicker(DefaultNetReportTime)
 	for {
 		select {
 		case t := <-ticker.C:
-			for _, ifName := range helper.PINetIfaces {
+			// interfaces are discovered on every tick to pick up hot-plugged ones
+			ifNames, err := getNetworkInterfaces(BaseNetStatsDir)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			pruneNetIFStats(prevStats, prevTime, ifNames)
+
+			for _, ifName := range ifNames {
 				stat, err := getNetworkIfStatistics(ifName)
 				if err != nil {
 					log.Println(err)
+					continue
+				}
+
+				prev, ok := prevStats[ifName]
+				prevStats[ifName] = stat
+				if !ok {
+					prevTime[ifName] = t
+					continue
 				}
 
-				err = reportNetStatsToInflux(dbName, hostname, stat, t, c)
+				rates, ok := getNetworkIfRates(prev, stat, t.Sub(prevTime[ifName]))
+				prevTime[ifName] = t
+				if !ok {
+					log.Printf("Counters for %s were reset, skipping sample\n", ifName)
+					continue
+				}
+
+				err = reportNetStatsToInflux(dbName, piName, stat, rates, t, c)
 				if err != nil {
 					log.Println(err)
 				}
@@ -61,6 +112,75 @@ func ReportNetworkStats(dbName string, c client.Client) error {
 	}
 }
 
+func getNetworkInterfaces(baseDir string) ([]string, error) {
+	// return the names of the interfaces in baseDir (normally /sys/class/net) that should be reported
+	entries, err := ioutil.ReadDir(baseDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var output []string
+	for _, elem := range entries {
+		ifName := elem.Name()
+		if helper.MatchPatterns(NetIfExcludePatterns, ifName) {
+			continue
+		}
+
+		included := helper.MatchPatterns(NetIfIncludePatterns, ifName)
+		if len(NetIfIncludePatterns) > 0 && !included {
+			continue
+		}
+
+		if !included {
+			// loopback and virtual devices need to be asked for explicitly
+			ifType, _ := ioutil.ReadFile(filepath.Join(baseDir, ifName, "type"))
+			if strings.TrimSpace(string(ifType)) == ARPHRDLoopback {
+				continue
+			}
+			if isVirtualNetIf(baseDir, ifName) && !NetIfIncludeVirtual {
+				continue
+			}
+		}
+
+		output = append(output, ifName)
+	}
+
+	return output, nil
+}
+
+func isVirtualNetIf(baseDir, ifName string) bool {
+	// entries in /sys/class/net are links to the device, virtual devices live under /sys/devices/virtual/
+	target, err := os.Readlink(filepath.Join(baseDir, ifName))
+	if err != nil {
+		return false
+	}
+	return strings.Contains(target, "/devices/virtual/")
+}
+
+func isWirelessNetIf(baseDir, ifName string) bool {
+	// wireless interfaces have a wireless directory in sysfs
+	_, err := os.Stat(filepath.Join(baseDir, ifName, "wireless"))
+	return err == nil
+}
+
+func pruneNetIFStats(prevStats map[string]NetIFStats, prevTime map[string]time.Time, ifNames []string) {
+	// forget interfaces that went away, so a re-plugged interface starts from a new baseline
+	for k := range prevStats {
+		found := false
+		for _, elem := range ifNames {
+			if k == elem {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			delete(prevStats, k)
+			delete(prevTime, k)
+		}
+	}
+}
+
 func getNetworkIfStatistics(ifName string) (NetIFStats, error) {
 	// get statistics for a wired interface from the Linux sysfs filesystem
 	// https://man7.org/linux/man-pages/man5/sysfs.5.html
@@ -69,14 +189,18 @@ func getNetworkIfStatistics(ifName string) (NetIFStats, error) {
 	var statsMap = make(map[string]int64)
 	statsDir := BaseNetStatsDir + ifName + "/"
 
-	stat, err := ioutil.ReadFile(statsDir + "speed")
 	sample.IfName = ifName
-	sample.Speed, err = strconv.ParseInt(strings.TrimSuffix(string(stat), "\n"), 10, 64)
+	if !isWirelessNetIf(BaseNetStatsDir, ifName) {
+		// reading speed fails on wireless interfaces, their bitrate is reported by ReportWirelessStats
+		stat, _ := ioutil.ReadFile(statsDir + "speed")
+		sample.Speed, _ = strconv.ParseInt(strings.TrimSuffix(string(stat), "\n"), 10, 64)
+	}
 	statsDir += "statistics/"
 
 	// go through all the statistics
 	for _, elem := range NetStatsList {
 		path := statsDir + elem
+		var stat []byte
 		stat, err = ioutil.ReadFile(path)
 		statInt, _ := strconv.ParseInt(strings.TrimSuffix(string(stat), "\n"), 10, 64)
 		statsMap[elem] = statInt
@@ -86,7 +210,53 @@ func getNetworkIfStatistics(ifName string) (NetIFStats, error) {
 	return sample, err
 }
 
-func reportNetStatsToInflux(dbName, piName string, stat NetIFStats, now time.Time, c client.Client) error {
+func getNetworkIfRates(pStat, nStat NetIFStats, elapsed time.Duration) (NetIFRates, bool) {
+	// pStat is the previous sample of the interface, nStat is the latest one
+	// the counters in sysfs are 64 bits, so if any of them went backwards the interface
+	// was reset (e.g. the driver was reloaded) and nStat becomes the new baseline
+	rates := NetIFRates{IfName: nStat.IfName}
+	if elapsed <= 0 {
+		return rates, false
+	}
+
+	deltas := make(map[string]float64)
+	for _, elem := range NetStatsList {
+		prev, curr := pStat.Statistics[elem], nStat.Statistics[elem]
+		if curr < prev {
+			return rates, false
+		}
+		deltas[elem] = float64(curr - prev)
+	}
+
+	seconds := elapsed.Seconds()
+	rates.RxBitsPerSec = deltas["rx_bytes"] * 8 / seconds
+	rates.TxBitsPerSec = deltas["tx_bytes"] * 8 / seconds
+	rates.RxPacketsPerSec = deltas["rx_packets"] / seconds
+	rates.TxPacketsPerSec = deltas["tx_packets"] / seconds
+	rates.RxErrorsPerSec = deltas["rx_errors"] / seconds
+	rates.TxErrorsPerSec = deltas["tx_errors"] / seconds
+	rates.RxDroppedPerSec = deltas["rx_dropped"] / seconds
+	rates.TxDroppedPerSec = deltas["tx_dropped"] / seconds
+
+	if deltas["rx_packets"] > 0 {
+		rates.RxErrorRatio = deltas["rx_errors"] / deltas["rx_packets"]
+		rates.RxDropRatio = deltas["rx_dropped"] / deltas["rx_packets"]
+	}
+	if deltas["tx_packets"] > 0 {
+		rates.TxErrorRatio = deltas["tx_errors"] / deltas["tx_packets"]
+		rates.TxDropRatio = deltas["tx_dropped"] / deltas["tx_packets"]
+	}
+
+	if nStat.Speed > 0 {
+		linkBits := float64(nStat.Speed) * 1000000.0
+		rates.RxUtilisation = rates.RxBitsPerSec / linkBits * 100.0
+		rates.TxUtilisation = rates.TxBitsPerSec / linkBits * 100.0
+	}
+
+	return rates, true
+}
+
+func reportNetStatsToInflux(dbName, piName string, stat NetIFStats, rates NetIFRates, now time.Time, c client.Client) error {
 	tags := map[string]string{
 		"pi_name": piName,
 		"if_name": stat.IfName,
@@ -97,6 +267,23 @@ func reportNetStatsToInflux(dbName, piName string, stat NetIFStats, now time.Tim
 		fields[k] = v
 	}
 
+	fields["rx_bits_per_sec"] = rates.RxBitsPerSec
+	fields["tx_bits_per_sec"] = rates.TxBitsPerSec
+	fields["rx_packets_per_sec"] = rates.RxPacketsPerSec
+	fields["tx_packets_per_sec"] = rates.TxPacketsPerSec
+	fields["rx_errors_per_sec"] = rates.RxErrorsPerSec
+	fields["tx_errors_per_sec"] = rates.TxErrorsPerSec
+	fields["rx_dropped_per_sec"] = rates.RxDroppedPerSec
+	fields["tx_dropped_per_sec"] = rates.TxDroppedPerSec
+	fields["rx_error_ratio"] = rates.RxErrorRatio
+	fields["tx_error_ratio"] = rates.TxErrorRatio
+	fields["rx_drop_ratio"] = rates.RxDropRatio
+	fields["tx_drop_ratio"] = rates.TxDropRatio
+	if stat.Speed > 0 {
+		fields["rx_utilisation"] = rates.RxUtilisation
+		fields["tx_utilisation"] = rates.TxUtilisation
+	}
+
 	var dbInfoObj helper.DBInfo
 	dbInfoObj.DBName = dbName
 	dbInfoObj.MeasName = NetMeasurementsName
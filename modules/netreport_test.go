@@ -3,7 +3,9 @@ package modules
 import (
 	"fmt"
 	"log"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/dpinato/pi-reporter/helper"
 )
@@ -26,6 +28,91 @@ func Test_getWiredNetworkUsageSample(t *testing.T) {
 	})
 }
 
+func Test_getNetworkIfRates(t *testing.T) {
+	newStats := func(speed, rxBytes, rxPackets, rxErrors, txBytes, txPackets int64) NetIFStats {
+		stats := make(map[string]int64)
+		for _, elem := range NetStatsList {
+			stats[elem] = 0
+		}
+		stats["rx_bytes"] = rxBytes
+		stats["rx_packets"] = rxPackets
+		stats["rx_errors"] = rxErrors
+		stats["tx_bytes"] = txBytes
+		stats["tx_packets"] = txPackets
+		return NetIFStats{IfName: "eth0", Speed: speed, Statistics: stats}
+	}
+	prev := newStats(100, 1000000, 1000, 0, 500000, 800)
+
+	var tests = []struct {
+		curr      NetIFStats
+		elapsed   time.Duration
+		wantOk    bool
+		wantRates NetIFRates
+	}{
+		{newStats(100, 13500000, 11000, 10, 3000000, 2800), 10 * time.Second, true,
+			NetIFRates{IfName: "eth0", RxBitsPerSec: 10000000, TxBitsPerSec: 2000000,
+				RxPacketsPerSec: 1000, TxPacketsPerSec: 200, RxErrorsPerSec: 1, RxErrorRatio: 0.001,
+				RxUtilisation: 10, TxUtilisation: 2}},
+		// link speed unknown, e.g. wireless
+		{newStats(0, 1000000, 1000, 0, 500000, 800), 10 * time.Second, true,
+			NetIFRates{IfName: "eth0"}},
+		// interface flapped and counters restarted
+		{newStats(100, 2000, 10, 0, 1000, 5), 10 * time.Second, false, NetIFRates{}},
+	}
+
+	for i, tt := range tests {
+		testname := fmt.Sprintf("%d", i)
+		t.Run(testname, func(t *testing.T) {
+			got, ok := getNetworkIfRates(prev, tt.curr, tt.elapsed)
+			if ok != tt.wantOk {
+				t.Fatalf("Got ok %v, want %v", ok, tt.wantOk)
+			}
+			if ok && got != tt.wantRates {
+				t.Errorf("Got %+v, want %+v", got, tt.wantRates)
+			}
+		})
+	}
+}
+
+func Test_getNetworkInterfaces(t *testing.T) {
+	var tests = []struct {
+		include        []string
+		exclude        []string
+		includeVirtual bool
+		want           []string
+	}{
+		{[]string{}, []string{}, false, []string{"enxb827eb000001", "eth0", "wlan0"}},
+		{[]string{}, []string{"wlan*"}, false, []string{"enxb827eb000001", "eth0"}},
+		{[]string{}, []string{}, true, []string{"docker0", "enxb827eb000001", "eth0", "wg0", "wlan0"}},
+		{[]string{"eth*", "wg0"}, []string{}, false, []string{"eth0", "wg0"}},
+		{[]string{"re:^(enx|wlan)"}, []string{"re:^wlan"}, false, []string{"enxb827eb000001"}},
+		{[]string{"lo"}, []string{}, false, []string{"lo"}},
+	}
+
+	defer func() {
+		NetIfIncludePatterns = []string{}
+		NetIfExcludePatterns = []string{}
+		NetIfIncludeVirtual = false
+	}()
+
+	for i, tt := range tests {
+		testname := fmt.Sprintf("%d", i)
+		t.Run(testname, func(t *testing.T) {
+			NetIfIncludePatterns = tt.include
+			NetIfExcludePatterns = tt.exclude
+			NetIfIncludeVirtual = tt.includeVirtual
+
+			got, err := getNetworkInterfaces("../TestFiles/sys/class/net")
+			if err != nil {
+				t.Fatalf("Got error, %v\n", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 // benchmarks
 func benchmarkGetNetworkIfStatistics(ifName string, b *testing.B) {
 	for i := 0; i < b.N; i++ {
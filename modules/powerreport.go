@@ -0,0 +1,287 @@
+package modules
+
+import (
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/dpinato/pi-reporter/helper"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+const DefaultPowerReportTime = 30 * time.Second
+const BasePowerSupplyDir = "/sys/class/power_supply/"
+const PowerMeasurementsName = "power_supply_stats"
+const PowerEventsMeasurementsName = "power_supply_events"
+
+// types of power supply event
+const (
+	PowerEventLowBattery    = "low_battery"
+	PowerEventBatteryOK     = "battery_recovered"
+	PowerEventStatusChanged = "status_changed"
+	PowerEventOnlineChanged = "online_changed"
+)
+
+// PowerLowBatteryPercent is the capacity under which a low_battery event is reported
+var PowerLowBatteryPercent = 20.0
+
+// PowerLowBatteryMargin is how far above PowerLowBatteryPercent the capacity of a low battery has to
+// rise before it is no longer low, so that a capacity jittering around the threshold is reported once
+const PowerLowBatteryMargin = 5.0
+
+// PowerTypeBattery is the type of the supplies whose capacity is checked
+const PowerTypeBattery = "Battery"
+
+// PowerSupplyValues maps the numeric attributes of a power supply to the field reported and the divisor
+// that converts the value to the field unit
+// https://www.kernel.org/doc/Documentation/ABI/testing/sysfs-class-power
+var PowerSupplyValues = map[string]struct {
+	Field   string
+	Divisor float64
+}{
+	"online":             {"online", 1.0},
+	"present":            {"present", 1.0},
+	"capacity":           {"capacity", 1.0},                 // percent
+	"voltage_now":        {"voltage", 1000000.0},            // uV
+	"current_now":        {"current", 1000000.0},            // uA
+	"power_now":          {"power", 1000000.0},              // uW
+	"energy_now":         {"energy", 1000000.0},             // uWh
+	"charge_now":         {"charge", 1000000.0},             // uAh
+	"temp":               {"temperature", 10.0},             // tenths of Celsius
+	"current_max":        {"current_max", 1000000.0},        // uA
+	"voltage_min_design": {"voltage_min_design", 1000000.0}, // uV
+}
+
+// PowerSupplyStats contains the state of one power supply
+type PowerSupplyStats struct {
+	Name          string
+	Type          string // e.g. Battery, Mains, USB, UPS
+	Status        string // batteries only, e.g. Charging, Discharging, Full
+	Health        string // e.g. Good, Overheat
+	CapacityLevel string // e.g. Normal, Low, Critical
+	Values        map[string]float64
+	LowBattery    bool // batteries only, see isPowerSupplyLow
+}
+
+// PowerSupplyEvent describes a change of state of a power supply
+type PowerSupplyEvent struct {
+	Type   string
+	Supply string
+	Old    string
+	New    string
+}
+
+func ReportPowerSupplyStats(dbName, piName string, c client.Client) error {
+	log.Printf("ReportPowerSupplyStats() is starting, %s\n", piName)
+
+	// events are reported against the previous sample, a battery that is low at startup is reported too
+	prevStats := make(map[string]PowerSupplyStats)
+
+	ticker := time.NewTicker(DefaultPowerReportTime)
+	for {
+		select {
+		case t := <-ticker.C:
+			// supplies are listed on every tick, HAT drivers may be loaded after pi-reporter starts
+			stats, err := getPowerSupplyStats(BasePowerSupplyDir)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+
+			currStats := make(map[string]PowerSupplyStats)
+			for _, elem := range stats {
+				prev, ok := prevStats[elem.Name]
+				elem.LowBattery = isPowerSupplyLow(prev, ok, elem)
+				currStats[elem.Name] = elem
+				err = reportPowerSupplyStatsToInflux(dbName, piName, elem, t, c)
+				if err != nil {
+					log.Println(err)
+				}
+
+				for _, event := range getPowerSupplyEvents(prev, ok, elem) {
+					log.Printf("%s %s: %s -> %s\n", event.Type, event.Supply, event.Old, event.New)
+					err = reportPowerSupplyEventToInflux(dbName, piName, event, t, c)
+					if err != nil {
+						log.Println(err)
+					}
+				}
+			}
+			prevStats = currStats
+		}
+	}
+}
+
+func getPowerSupplyStats(baseDir string) ([]PowerSupplyStats, error) {
+	// read every power supply in baseDir, normally /sys/class/power_supply/
+	// boards without power supplies do not have the directory, nothing is reported for them
+	entries, err := ioutil.ReadDir(baseDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var output []PowerSupplyStats
+	for _, elem := range entries {
+		supplyDir := filepath.Join(baseDir, elem.Name())
+		stats := PowerSupplyStats{
+			Name:          elem.Name(),
+			Type:          readSysfsString(filepath.Join(supplyDir, "type")),
+			Status:        readSysfsString(filepath.Join(supplyDir, "status")),
+			Health:        readSysfsString(filepath.Join(supplyDir, "health")),
+			CapacityLevel: readSysfsString(filepath.Join(supplyDir, "capacity_level")),
+			Values:        make(map[string]float64),
+		}
+
+		for attr, kind := range PowerSupplyValues {
+			value, err := readSysfsInt(filepath.Join(supplyDir, attr))
+			if err != nil {
+				// the attributes exposed depend on the driver
+				continue
+			}
+			stats.Values[kind.Field] = float64(value) / kind.Divisor
+		}
+
+		// most fuel gauges do not report power, compute it when voltage and current are known
+		_, hasPower := stats.Values["power"]
+		voltage, hasVoltage := stats.Values["voltage"]
+		current, hasCurrent := stats.Values["current"]
+		if !hasPower && hasVoltage && hasCurrent {
+			stats.Values["power"] = math.Abs(voltage * current)
+		}
+
+		output = append(output, stats)
+	}
+
+	sort.Slice(output, func(i, j int) bool { return output[i].Name < output[j].Name })
+	return output, nil
+}
+
+func isPowerSupplyLow(prev PowerSupplyStats, hasPrev bool, curr PowerSupplyStats) bool {
+	// a battery is low under PowerLowBatteryPercent and stays low until it is charged past the margin
+	capacity, ok := curr.Values["capacity"]
+	if curr.Type != PowerTypeBattery || !ok {
+		return false
+	}
+
+	if hasPrev && prev.LowBattery {
+		return capacity < PowerLowBatteryPercent+PowerLowBatteryMargin
+	}
+	return capacity < PowerLowBatteryPercent
+}
+
+func getPowerSupplyEvents(prev PowerSupplyStats, hasPrev bool, curr PowerSupplyStats) []PowerSupplyEvent {
+	// compare the latest sample of a supply with the previous one, hasPrev is false for the first sample
+	// LowBattery has to be set on both samples, see isPowerSupplyLow
+	var output []PowerSupplyEvent
+
+	capacity := curr.Values["capacity"]
+	prevCapacity, prevOk := prev.Values["capacity"]
+	wasLow := hasPrev && prev.LowBattery
+	if curr.LowBattery && !wasLow {
+		output = append(output, PowerSupplyEvent{PowerEventLowBattery, curr.Name,
+			formatPowerCapacity(prevCapacity, hasPrev && prevOk), formatPowerCapacity(capacity, true)})
+	}
+	if !curr.LowBattery && wasLow {
+		output = append(output, PowerSupplyEvent{PowerEventBatteryOK, curr.Name,
+			formatPowerCapacity(prevCapacity, prevOk), formatPowerCapacity(capacity, true)})
+	}
+
+	if !hasPrev {
+		return output
+	}
+
+	if prev.Status != curr.Status {
+		output = append(output, PowerSupplyEvent{PowerEventStatusChanged, curr.Name, prev.Status, curr.Status})
+	}
+	prevOnline, prevOk := prev.Values["online"]
+	online, ok := curr.Values["online"]
+	if prevOk && ok && prevOnline != online {
+		output = append(output, PowerSupplyEvent{PowerEventOnlineChanged, curr.Name,
+			formatPowerOnline(prevOnline), formatPowerOnline(online)})
+	}
+
+	return output
+}
+
+func formatPowerCapacity(capacity float64, ok bool) string {
+	if !ok {
+		return "unknown"
+	}
+	return strconv.FormatFloat(capacity, 'f', -1, 64) + "%"
+}
+
+func formatPowerOnline(online float64) string {
+	if online > 0 {
+		return "online"
+	}
+	return "offline"
+}
+
+func reportPowerSupplyStatsToInflux(dbName, piName string, stat PowerSupplyStats, now time.Time, c client.Client) error {
+	tags := map[string]string{
+		"pi_name": piName,
+		"supply":  stat.Name,
+		"type":    stat.Type,
+	}
+	fields := map[string]interface{}{}
+	for k, v := range stat.Values {
+		fields[k] = v
+	}
+	if stat.Status != "" {
+		fields["status"] = stat.Status
+	}
+	if stat.Health != "" {
+		fields["health"] = stat.Health
+	}
+	if stat.CapacityLevel != "" {
+		fields["capacity_level"] = stat.CapacityLevel
+	}
+	if _, ok := stat.Values["capacity"]; ok && stat.Type == PowerTypeBattery {
+		fields["low_battery"] = stat.LowBattery
+	}
+
+	var dbInfoObj helper.DBInfo
+	dbInfoObj.DBName = dbName
+	dbInfoObj.MeasName = PowerMeasurementsName
+	dbInfoObj.Tags = tags
+	dbInfoObj.Fields = fields
+	dbInfoObj.Now = now
+
+	err := helper.ReportStatsToInflux(dbInfoObj, c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func reportPowerSupplyEventToInflux(dbName, piName string, event PowerSupplyEvent, now time.Time, c client.Client) error {
+	tags := map[string]string{
+		"pi_name": piName,
+		"event":   event.Type,
+		"supply":  event.Supply,
+	}
+	fields := map[string]interface{}{
+		"old": event.Old,
+		"new": event.New,
+	}
+
+	var dbInfoObj helper.DBInfo
+	dbInfoObj.DBName = dbName
+	dbInfoObj.MeasName = PowerEventsMeasurementsName
+	dbInfoObj.Tags = tags
+	dbInfoObj.Fields = fields
+	dbInfoObj.Now = now
+
+	err := helper.ReportStatsToInflux(dbInfoObj, c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package modules
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func Test_getPowerSupplyStats(t *testing.T) {
+	got, err := getPowerSupplyStats("../TestFiles/sys/class/power_supply/")
+	if err != nil {
+		t.Fatalf("Got error, %v\n", err)
+	}
+
+	want := []PowerSupplyStats{
+		{Name: "BAT0", Type: "Battery", Status: "Discharging", Health: "Good", CapacityLevel: "Low",
+			Values: map[string]float64{"present": 1, "capacity": 18, "voltage": 3.7, "current": -0.85,
+				"power": 3.145, "temperature": 25.1}},
+		{Name: "rpi-poe-power-supply@0", Type: "Mains", Values: map[string]float64{"online": 1, "current_max": 2.5}},
+		{Name: "usb", Type: "USB", Values: map[string]float64{"online": 0}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		// power is computed, so allow for rounding
+		if p, ok := got[i].Values["power"]; ok && math.Abs(p-want[i].Values["power"]) < 1e-9 {
+			got[i].Values["power"] = want[i].Values["power"]
+		}
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("Got %+v, want %+v", got[i], want[i])
+		}
+	}
+
+	// boards without power supplies report nothing
+	got, err = getPowerSupplyStats("../TestFiles/sys/class/missing/")
+	if err != nil || len(got) != 0 {
+		t.Errorf("Got %v and error %v for a missing directory, want nothing", got, err)
+	}
+}
+
+func Test_getPowerSupplyEvents(t *testing.T) {
+	battery := func(status string, capacity float64, low bool) PowerSupplyStats {
+		return PowerSupplyStats{Name: "BAT0", Type: PowerTypeBattery, Status: status,
+			Values: map[string]float64{"capacity": capacity}, LowBattery: low}
+	}
+	mains := func(online float64) PowerSupplyStats {
+		return PowerSupplyStats{Name: "AC", Type: "Mains", Values: map[string]float64{"online": online}}
+	}
+
+	var tests = []struct {
+		name    string
+		prev    PowerSupplyStats
+		hasPrev bool
+		curr    PowerSupplyStats
+		want    []PowerSupplyEvent
+	}{
+		{"low at startup", PowerSupplyStats{}, false, battery("Discharging", 15, true),
+			[]PowerSupplyEvent{{PowerEventLowBattery, "BAT0", "unknown", "15%"}}},
+		{"ok at startup", PowerSupplyStats{}, false, battery("Discharging", 80, false), nil},
+		{"crossing low", battery("Discharging", 21, false), true, battery("Discharging", 19.5, true),
+			[]PowerSupplyEvent{{PowerEventLowBattery, "BAT0", "21%", "19.5%"}}},
+		{"staying low", battery("Discharging", 19, true), true, battery("Discharging", 18, true), nil},
+		{"jitter", battery("Charging", 19, true), true, battery("Charging", 20, true), nil},
+		{"recovered", battery("Charging", 24, true), true, battery("Charging", 25, false),
+			[]PowerSupplyEvent{{PowerEventBatteryOK, "BAT0", "24%", "25%"}}},
+		{"mains lost", battery("Charging", 90, false), true, battery("Discharging", 90, false),
+			[]PowerSupplyEvent{{PowerEventStatusChanged, "BAT0", "Charging", "Discharging"}}},
+		{"offline", mains(1), true, mains(0),
+			[]PowerSupplyEvent{{PowerEventOnlineChanged, "AC", "online", "offline"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := getPowerSupplyEvents(tt.prev, tt.hasPrev, tt.curr)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_isPowerSupplyLow(t *testing.T) {
+	battery := func(capacity float64, low bool) PowerSupplyStats {
+		return PowerSupplyStats{Name: "BAT0", Type: PowerTypeBattery,
+			Values: map[string]float64{"capacity": capacity}, LowBattery: low}
+	}
+
+	var tests = []struct {
+		name    string
+		prev    PowerSupplyStats
+		hasPrev bool
+		curr    PowerSupplyStats
+		want    bool
+	}{
+		{"low at startup", PowerSupplyStats{}, false, battery(15, false), true},
+		{"ok at startup", PowerSupplyStats{}, false, battery(20, false), false},
+		{"crossing low", battery(21, false), true, battery(19, false), true},
+		{"jitter above threshold", battery(19, true), true, battery(20, false), true},
+		{"jitter within margin", battery(20, true), true, battery(24.5, false), true},
+		{"recovered", battery(24.5, true), true, battery(25, false), false},
+		{"not low within margin", battery(26, false), true, battery(22, false), false},
+		{"not a battery", PowerSupplyStats{}, false,
+			PowerSupplyStats{Name: "rpi-poe", Type: "Mains", Values: map[string]float64{"capacity": 10}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := isPowerSupplyLow(tt.prev, tt.hasPrev, tt.curr)
+			if got != tt.want {
+				t.Errorf("Got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+package modules
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/dpinato/pi-reporter/helper"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+const DefaultProbeReportTime = 60 * time.Second
+const ProbeMeasurementsName = "probe"
+
+// types of probe, a target is configured as <type>:<target>
+const (
+	ProbeICMP = "icmp" // icmp:<host>
+	ProbeTCP  = "tcp"  // tcp:<host>:<port>
+	ProbeHTTP = "http" // http:<url>
+	ProbeDNS  = "dns"  // dns:<name> or dns:<name>@<server>:<port>
+)
+
+// ProbeTimeout is the time allowed to each probe, and to each echo request of ICMP probes
+var ProbeTimeout = 5 * time.Second
+
+// ProbeICMPCount is the number of echo requests sent by each ICMP probe
+var ProbeICMPCount = 3
+
+// probeHTTPTransport is used by HTTP probes, the default transport when nil;
+// tests replace it to trust the certificate of their server
+var probeHTTPTransport http.RoundTripper
+
+// ProbeTargets are the targets probed, the collector is disabled when empty
+var ProbeTargets = []ProbeTarget{}
+
+// ProbeTarget is one target to probe
+type ProbeTarget struct {
+	Type   string
+	Target string
+}
+
+// ProbeResult contains the outcome of probing one target
+type ProbeResult struct {
+	Target      ProbeTarget
+	Success     bool
+	Latency     time.Duration // average round trip time for ICMP probes
+	LossPercent float64       // ICMP probes only
+	StatusCode  int           // HTTP probes only
+	TLSExpiry   time.Time     // HTTPS probes only, expiry of the certificate of the server
+	Addresses   int           // DNS probes only, number of addresses returned
+	Error       string
+}
+
+// ParseProbeTargets parses a list of targets like icmp:8.8.8.8 or http:https://example.com/
+func ParseProbeTargets(targets []string) ([]ProbeTarget, error) {
+	var output []ProbeTarget
+	for _, elem := range targets {
+		pos := strings.Index(elem, ":")
+		if pos == -1 || pos == len(elem)-1 {
+			return nil, fmt.Errorf("bad probe target %s, expected <type>:<target>", elem)
+		}
+
+		target := ProbeTarget{Type: elem[0:pos], Target: elem[pos+1:]}
+		switch target.Type {
+		case ProbeICMP, ProbeHTTP, ProbeDNS:
+		case ProbeTCP:
+			if _, _, err := net.SplitHostPort(target.Target); err != nil {
+				return nil, fmt.Errorf("bad TCP probe target %s, %v", elem, err)
+			}
+		default:
+			return nil, fmt.Errorf("unknown probe type %s", target.Type)
+		}
+		output = append(output, target)
+	}
+
+	return output, nil
+}
+
+func ReportProbes(dbName, piName string, c client.Client) error {
+	if len(ProbeTargets) == 0 {
+		return errors.New("no probe targets configured")
+	}
+
+	log.Printf("ReportProbes() is starting, %s\n", piName)
+
+	ticker := time.NewTicker(DefaultProbeReportTime)
+	for {
+		select {
+		case t := <-ticker.C:
+			// probes run at the same time, so a target that times out does not delay the others
+			var wg sync.WaitGroup
+			results := make([]ProbeResult, len(ProbeTargets))
+			for i, target := range ProbeTargets {
+				wg.Add(1)
+				go func(i int, target ProbeTarget) {
+					defer wg.Done()
+					results[i] = runProbe(target)
+				}(i, target)
+			}
+			wg.Wait()
+
+			for _, elem := range results {
+				err := reportProbeToInflux(dbName, piName, elem, t, c)
+				if err != nil {
+					log.Println(err)
+				}
+			}
+		}
+	}
+}
+
+func runProbe(target ProbeTarget) ProbeResult {
+	var result ProbeResult
+	var err error
+
+	switch target.Type {
+	case ProbeICMP:
+		result, err = probeICMP(target.Target)
+	case ProbeTCP:
+		result, err = probeTCP(target.Target)
+	case ProbeHTTP:
+		result, err = probeHTTP(target.Target)
+	case ProbeDNS:
+		result, err = probeDNS(target.Target)
+	default:
+		err = fmt.Errorf("unknown probe type %s", target.Type)
+	}
+
+	result.Target = target
+	result.Success = err == nil
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func probeTCP(address string) (ProbeResult, error) {
+	var result ProbeResult
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", address, ProbeTimeout)
+	if err != nil {
+		return result, err
+	}
+	result.Latency = time.Since(start)
+	conn.Close()
+	return result, nil
+}
+
+func probeHTTP(url string) (ProbeResult, error) {
+	// the probe fails on status codes >= 400, the certificate is checked as usual
+	var result ProbeResult
+	httpClient := http.Client{Timeout: ProbeTimeout, Transport: probeHTTPTransport}
+
+	start := time.Now()
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+	result.Latency = time.Since(start)
+	result.StatusCode = resp.StatusCode
+
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		result.TLSExpiry = resp.TLS.PeerCertificates[0].NotAfter
+	}
+
+	if resp.StatusCode >= 400 {
+		return result, fmt.Errorf("HTTP status %s", resp.Status)
+	}
+	return result, nil
+}
+
+func probeDNS(target string) (ProbeResult, error) {
+	// target is a name, optionally followed by @<server>:<port> to query a specific server
+	var result ProbeResult
+	resolver := net.DefaultResolver
+	name := target
+	if pos := strings.LastIndex(target, "@"); pos != -1 {
+		name = target[0:pos]
+		server := target[pos+1:]
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				d := net.Dialer{}
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ProbeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	addrs, err := resolver.LookupHost(ctx, name)
+	if err != nil {
+		return result, err
+	}
+	result.Latency = time.Since(start)
+	result.Addresses = len(addrs)
+	return result, nil
+}
+
+func probeICMP(host string) (ProbeResult, error) {
+	// send ProbeICMPCount echo requests through an unprivileged ICMP datagram socket,
+	// which requires the group of the process to be in net.ipv4.ping_group_range
+	// the loss is 100% until an echo request is sent, so a host that cannot be reached is not reported as 0%
+	result := ProbeResult{LossPercent: 100.0}
+
+	ipAddr, err := net.ResolveIPAddr("ip4", host)
+	if err != nil {
+		return result, err
+	}
+
+	conn, err := newICMPConn()
+	if err != nil {
+		return result, err
+	}
+	defer conn.Close()
+
+	var sent, received int
+	var totalRtt time.Duration
+	var writeErr error
+	dst := &net.UDPAddr{IP: ipAddr.IP}
+	buf := make([]byte, 1500)
+	for seq := 1; seq <= ProbeICMPCount; seq++ {
+		start := time.Now()
+		_, writeErr = conn.WriteTo(newICMPEchoRequest(seq), dst)
+		if writeErr != nil {
+			break
+		}
+		sent++
+
+		// the kernel sets the identifier of the packets, so match the replies by sequence number
+		conn.SetReadDeadline(start.Add(ProbeTimeout))
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				break
+			}
+			if isICMPEchoReply(buf[:n], seq) {
+				received++
+				totalRtt += time.Since(start)
+				break
+			}
+		}
+	}
+
+	// the loss is over the echo requests actually sent
+	if sent > 0 {
+		result.LossPercent = float64(sent-received) / float64(sent) * 100.0
+	}
+	if received == 0 {
+		if writeErr != nil {
+			return result, writeErr
+		}
+		return result, fmt.Errorf("no reply from %s", host)
+	}
+	result.Latency = totalRtt / time.Duration(received)
+	return result, nil
+}
+
+func newICMPConn() (net.PacketConn, error) {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM, syscall.IPPROTO_ICMP)
+	if err != nil {
+		return nil, fmt.Errorf("could not open ICMP socket, check net.ipv4.ping_group_range, %w", err)
+	}
+
+	f := os.NewFile(uintptr(fd), "icmp")
+	defer f.Close()
+	return net.FilePacketConn(f)
+}
+
+func newICMPEchoRequest(seq int) []byte {
+	// type 8 (echo request), code 0, checksum, identifier (set by the kernel), sequence number
+	msg := make([]byte, 16)
+	msg[0] = 8
+	binary.BigEndian.PutUint16(msg[6:8], uint16(seq))
+	copy(msg[8:], "pi-rptr!")
+	binary.BigEndian.PutUint16(msg[2:4], icmpChecksum(msg))
+	return msg
+}
+
+func isICMPEchoReply(msg []byte, seq int) bool {
+	// datagram sockets return the ICMP message without the IP header
+	return len(msg) >= 8 && msg[0] == 0 && binary.BigEndian.Uint16(msg[6:8]) == uint16(seq)
+}
+
+func icmpChecksum(msg []byte) uint16 {
+	// internet checksum, RFC 1071
+	var sum uint32
+	for i := 0; i+1 < len(msg); i += 2 {
+		sum += uint32(msg[i])<<8 | uint32(msg[i+1])
+	}
+	if len(msg)%2 == 1 {
+		sum += uint32(msg[len(msg)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = (sum & 0xffff) + (sum >> 16)
+	}
+	return ^uint16(sum)
+}
+
+func reportProbeToInflux(dbName, piName string, result ProbeResult, now time.Time, c client.Client) error {
+	tags := map[string]string{
+		"pi_name":    piName,
+		"probe_type": result.Target.Type,
+		"target":     result.Target.Target,
+	}
+	fields := map[string]interface{}{
+		"success": result.Success,
+	}
+	if result.Success || result.Latency > 0 {
+		fields["latency_ms"] = float64(result.Latency) / float64(time.Millisecond)
+	}
+	if result.Error != "" {
+		fields["error"] = result.Error
+	}
+
+	switch result.Target.Type {
+	case ProbeICMP:
+		fields["loss_percent"] = result.LossPercent
+	case ProbeHTTP:
+		if result.StatusCode != 0 {
+			fields["status_code"] = result.StatusCode
+		}
+		if !result.TLSExpiry.IsZero() {
+			fields["tls_expiry_seconds"] = int64(time.Until(result.TLSExpiry).Seconds())
+		}
+	case ProbeDNS:
+		fields["addresses"] = result.Addresses
+	}
+
+	var dbInfoObj helper.DBInfo
+	dbInfoObj.DBName = dbName
+	dbInfoObj.MeasName = ProbeMeasurementsName
+	dbInfoObj.Tags = tags
+	dbInfoObj.Fields = fields
+	dbInfoObj.Now = now
+
+	err := helper.ReportStatsToInflux(dbInfoObj, c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
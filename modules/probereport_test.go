@@ -0,0 +1,131 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func Test_ParseProbeTargets(t *testing.T) {
+	var tests = []struct {
+		targets []string
+		want    []ProbeTarget
+		wantErr bool
+	}{
+		{[]string{"icmp:192.168.1.1", "tcp:example.com:443", "http:https://example.com/status", "dns:example.com@1.1.1.1:53"},
+			[]ProbeTarget{{"icmp", "192.168.1.1"}, {"tcp", "example.com:443"},
+				{"http", "https://example.com/status"}, {"dns", "example.com@1.1.1.1:53"}}, false},
+		{[]string{"tcp:example.com"}, nil, true},
+		{[]string{"smtp:example.com:25"}, nil, true},
+		{[]string{"icmp:"}, nil, true},
+		{[]string{"example.com"}, nil, true},
+	}
+
+	for i, tt := range tests {
+		testname := fmt.Sprintf("%d", i)
+		t.Run(testname, func(t *testing.T) {
+			got, err := ParseProbeTargets(tt.targets)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_probeTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen, %v\n", err)
+	}
+	addr := l.Addr().String()
+
+	got := runProbe(ProbeTarget{ProbeTCP, addr})
+	if !got.Success || got.Latency <= 0 {
+		t.Errorf("Probe of listening port failed, %+v", got)
+	}
+
+	l.Close()
+	got = runProbe(ProbeTarget{ProbeTCP, addr})
+	if got.Success || got.Error == "" {
+		t.Errorf("Probe of closed port succeeded, %+v", got)
+	}
+}
+
+func Test_probeHTTP(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	}))
+	defer ts.Close()
+
+	probeHTTPTransport = ts.Client().Transport
+	defer func() { probeHTTPTransport = nil }()
+
+	got := runProbe(ProbeTarget{ProbeHTTP, ts.URL + "/"})
+	if !got.Success || got.StatusCode != 200 {
+		t.Errorf("Probe failed, %+v", got)
+	}
+	if !got.TLSExpiry.After(time.Now()) {
+		t.Errorf("Got TLS expiry %v, want a time in the future", got.TLSExpiry)
+	}
+
+	got = runProbe(ProbeTarget{ProbeHTTP, ts.URL + "/missing"})
+	if got.Success || got.StatusCode != 404 {
+		t.Errorf("Probe of missing page succeeded, %+v", got)
+	}
+}
+
+func Test_probeDNS(t *testing.T) {
+	got := runProbe(ProbeTarget{ProbeDNS, "localhost"})
+	if !got.Success || got.Addresses == 0 {
+		t.Errorf("Probe of localhost failed, %+v", got)
+	}
+}
+
+func Test_probeICMP(t *testing.T) {
+	got := runProbe(ProbeTarget{ProbeICMP, "127.0.0.1"})
+	if !got.Success {
+		if _, err := newICMPConn(); errors.Is(err, syscall.EACCES) {
+			t.Skipf("Unprivileged ICMP sockets are not allowed, %v", err)
+		}
+		t.Errorf("Probe of loopback failed, %+v", got)
+	}
+	if got.LossPercent != 0 {
+		t.Errorf("Got loss %f, want 0", got.LossPercent)
+	}
+}
+
+func Test_probeICMPUnresolved(t *testing.T) {
+	// a host that cannot be resolved loses every echo request
+	got := runProbe(ProbeTarget{ProbeICMP, "missing..invalid"})
+	if got.Success || got.LossPercent != 100 {
+		t.Errorf("Got %+v for a host that cannot be resolved, want a failure with 100%% loss", got)
+	}
+}
+
+func Test_icmpChecksum(t *testing.T) {
+	msg := newICMPEchoRequest(1)
+
+	// the checksum of a message including its checksum is 0
+	if got := icmpChecksum(msg); got != 0 {
+		t.Errorf("Got checksum %x of a valid message, want 0", got)
+	}
+
+	reply := append([]byte{}, msg...)
+	reply[0] = 0
+	if !isICMPEchoReply(reply, 1) || isICMPEchoReply(reply, 2) || isICMPEchoReply(msg, 1) {
+		t.Errorf("Echo replies are not matched correctly")
+	}
+}
@@ -0,0 +1,327 @@
+package modules
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dpinato/pi-reporter/helper"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+const DefaultProcReportTime = 30 * time.Second
+const BaseProcDir = "/proc/"
+const ProcMeasurementsName = "process_stats"
+
+// ProcClockTicks is the number of clock ticks per second used by /proc/[pid]/stat (USER_HZ),
+// which is 100 on every architecture the PI runs
+const ProcClockTicks = 100
+
+// ProcNamePatterns selects processes that are always reported, by name
+var ProcNamePatterns = []string{}
+
+// ProcTopN is the number of processes reported by CPU usage and by memory usage, on top of
+// the ones matching ProcNamePatterns; processes are grouped by name and user, so the number of
+// series is bounded by the number of names seen in the top N over time
+var ProcTopN = 5
+
+// ProcSample contains the statistics of one process read from /proc/[pid]
+type ProcSample struct {
+	PID        int
+	Name       string
+	UID        string
+	StartTime  int64 // time the process started after boot (clock ticks), to detect PID reuse
+	CPUTicks   int64 // user and system time (clock ticks)
+	Threads    int64
+	RSS        int64 // bytes
+	FDs        int64
+	ReadBytes  int64 // bytes read from storage, -1 when /proc/[pid]/io cannot be read
+	WriteBytes int64
+}
+
+// ProcStats contains the statistics of all the processes with the same name and user
+type ProcStats struct {
+	Name             string
+	User             string
+	Processes        int64
+	CPUPercent       float64 // percentage of one core
+	RSS              int64
+	Threads          int64
+	FDs              int64
+	ReadBytesPerSec  float64
+	WriteBytesPerSec float64
+}
+
+func ReportProcStats(dbName, piName string, c client.Client) error {
+	log.Printf("ReportProcStats() is starting, %s\n", piName)
+
+	// get first sample, CPU and I/O rates are computed against the previous sample
+	prevSamples, err := getProcSamples(BaseProcDir)
+	if err != nil {
+		log.Println(err)
+	}
+	prevTime := time.Now()
+
+	ticker := time.NewTicker(DefaultProcReportTime)
+	for {
+		select {
+		case t := <-ticker.C:
+			samples, err := getProcSamples(BaseProcDir)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+
+			stats := getProcStats(prevSamples, samples, t.Sub(prevTime))
+			prevSamples = samples
+			prevTime = t
+
+			for _, elem := range selectProcStats(stats) {
+				err = reportProcStatsToInflux(dbName, piName, elem, t, c)
+				if err != nil {
+					log.Println(err)
+				}
+			}
+		}
+	}
+}
+
+func getProcSamples(procDir string) (map[int]ProcSample, error) {
+	// read the statistics of every process in procDir, normally /proc/
+	entries, err := ioutil.ReadDir(procDir)
+	if err != nil {
+		return nil, err
+	}
+
+	output := make(map[int]ProcSample)
+	for _, elem := range entries {
+		pid, err := strconv.Atoi(elem.Name())
+		if err != nil {
+			continue
+		}
+
+		sample, err := getProcSample(filepath.Join(procDir, elem.Name()))
+		if err != nil {
+			// the process probably exited while reading it
+			continue
+		}
+		sample.PID = pid
+		output[pid] = sample
+	}
+
+	return output, nil
+}
+
+func getProcSample(pidDir string) (ProcSample, error) {
+	var sample ProcSample
+
+	data, err := ioutil.ReadFile(filepath.Join(pidDir, "stat"))
+	if err != nil {
+		return sample, err
+	}
+	err = getProcSampleFromStat(string(data), &sample)
+	if err != nil {
+		return sample, err
+	}
+
+	data, err = ioutil.ReadFile(filepath.Join(pidDir, "status"))
+	if err != nil {
+		return sample, err
+	}
+	sample.UID = getProcStatusValue(string(data), "Uid")
+
+	// io and fd are only readable for processes of the same user, unless running as root
+	sample.ReadBytes, sample.WriteBytes = -1, -1
+	data, err = ioutil.ReadFile(filepath.Join(pidDir, "io"))
+	if err == nil {
+		sample.ReadBytes, _ = strconv.ParseInt(getProcStatusValue(string(data), "read_bytes"), 10, 64)
+		sample.WriteBytes, _ = strconv.ParseInt(getProcStatusValue(string(data), "write_bytes"), 10, 64)
+	}
+
+	fds, err := ioutil.ReadDir(filepath.Join(pidDir, "fd"))
+	if err == nil {
+		sample.FDs = int64(len(fds))
+	}
+
+	return sample, nil
+}
+
+func getProcSampleFromStat(data string, sample *ProcSample) error {
+	// the name is between parentheses and may contain spaces and parentheses itself
+	// https://man7.org/linux/man-pages/man5/proc.5.html
+	start := strings.Index(data, "(")
+	end := strings.LastIndex(data, ")")
+	if start == -1 || end < start {
+		return fmt.Errorf("unexpected format of stat, %s", data)
+	}
+	sample.Name = data[start+1 : end]
+
+	// list[0] is the state, the third field of the file
+	list := strings.Fields(data[end+1:])
+	if len(list) < 22 {
+		return fmt.Errorf("unexpected format of stat, %s", data)
+	}
+
+	utime, _ := strconv.ParseInt(list[11], 10, 64)
+	stime, _ := strconv.ParseInt(list[12], 10, 64)
+	sample.CPUTicks = utime + stime
+	sample.Threads, _ = strconv.ParseInt(list[17], 10, 64)
+	sample.StartTime, _ = strconv.ParseInt(list[19], 10, 64)
+	rssPages, _ := strconv.ParseInt(list[21], 10, 64)
+	sample.RSS = rssPages * int64(os.Getpagesize())
+
+	return nil
+}
+
+func getProcStatusValue(data, key string) string {
+	// given the content of /proc/[pid]/status or io, return the first value of the line with the key provided
+	for _, line := range strings.Split(data, "\n") {
+		pos := strings.Index(line, ":")
+		if pos == -1 || line[0:pos] != key {
+			continue
+		}
+
+		list := strings.Fields(line[pos+1:])
+		if len(list) > 0 {
+			return list[0]
+		}
+	}
+
+	return ""
+}
+
+func getProcStats(pSamples, nSamples map[int]ProcSample, elapsed time.Duration) []ProcStats {
+	// pSamples is the previous sample of all processes, nSamples is the latest one
+	// processes are grouped by name and user, rates of processes that were not in the previous sample are 0
+	groups := make(map[[2]string]*ProcStats)
+	var output []ProcStats
+
+	for pid, curr := range nSamples {
+		key := [2]string{curr.Name, curr.UID}
+		group, ok := groups[key]
+		if !ok {
+			group = &ProcStats{Name: curr.Name, User: lookupUser(curr.UID)}
+			groups[key] = group
+		}
+
+		group.Processes++
+		group.RSS += curr.RSS
+		group.Threads += curr.Threads
+		group.FDs += curr.FDs
+
+		prev, ok := pSamples[pid]
+		if !ok || prev.StartTime != curr.StartTime || elapsed <= 0 {
+			continue
+		}
+
+		seconds := elapsed.Seconds()
+		if curr.CPUTicks >= prev.CPUTicks {
+			group.CPUPercent += float64(curr.CPUTicks-prev.CPUTicks) / ProcClockTicks / seconds * 100.0
+		}
+		if prev.ReadBytes >= 0 && curr.ReadBytes >= prev.ReadBytes {
+			group.ReadBytesPerSec += float64(curr.ReadBytes-prev.ReadBytes) / seconds
+		}
+		if prev.WriteBytes >= 0 && curr.WriteBytes >= prev.WriteBytes {
+			group.WriteBytesPerSec += float64(curr.WriteBytes-prev.WriteBytes) / seconds
+		}
+	}
+
+	for _, group := range groups {
+		output = append(output, *group)
+	}
+	sort.Slice(output, func(i, j int) bool {
+		if output[i].Name != output[j].Name {
+			return output[i].Name < output[j].Name
+		}
+		return output[i].User < output[j].User
+	})
+
+	return output
+}
+
+func selectProcStats(stats []ProcStats) []ProcStats {
+	// return the groups matching ProcNamePatterns, plus the top ProcTopN by CPU and by memory
+	selected := make(map[int]bool)
+	for i, elem := range stats {
+		if helper.MatchPatterns(ProcNamePatterns, elem.Name) {
+			selected[i] = true
+		}
+	}
+
+	byCPU := make([]int, len(stats))
+	byRSS := make([]int, len(stats))
+	for i := range stats {
+		byCPU[i] = i
+		byRSS[i] = i
+	}
+	sort.SliceStable(byCPU, func(i, j int) bool { return stats[byCPU[i]].CPUPercent > stats[byCPU[j]].CPUPercent })
+	sort.SliceStable(byRSS, func(i, j int) bool { return stats[byRSS[i]].RSS > stats[byRSS[j]].RSS })
+	for i := 0; i < ProcTopN && i < len(stats); i++ {
+		selected[byCPU[i]] = true
+		selected[byRSS[i]] = true
+	}
+
+	var output []ProcStats
+	for i, elem := range stats {
+		if selected[i] {
+			output = append(output, elem)
+		}
+	}
+
+	return output
+}
+
+var procUserCache = make(map[string]string)
+
+func lookupUser(uid string) string {
+	// return the name of the user, or the UID when it cannot be resolved
+	// only called from the collector goroutine, so the cache does not need a lock
+	if name, ok := procUserCache[uid]; ok {
+		return name
+	}
+
+	name := uid
+	if u, err := user.LookupId(uid); err == nil {
+		name = u.Username
+	}
+	procUserCache[uid] = name
+	return name
+}
+
+func reportProcStatsToInflux(dbName, piName string, stat ProcStats, now time.Time, c client.Client) error {
+	tags := map[string]string{
+		"pi_name":      piName,
+		"process_name": stat.Name,
+		"user":         stat.User,
+	}
+	fields := map[string]interface{}{
+		"processes":   stat.Processes,
+		"cpu_percent": stat.CPUPercent,
+		"rss":         stat.RSS,
+		"threads":     stat.Threads,
+		"open_fds":    stat.FDs,
+
+		"read_bytes_per_sec":  stat.ReadBytesPerSec,
+		"write_bytes_per_sec": stat.WriteBytesPerSec,
+	}
+
+	var dbInfoObj helper.DBInfo
+	dbInfoObj.DBName = dbName
+	dbInfoObj.MeasName = ProcMeasurementsName
+	dbInfoObj.Tags = tags
+	dbInfoObj.Fields = fields
+	dbInfoObj.Now = now
+
+	err := helper.ReportStatsToInflux(dbInfoObj, c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package modules
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_getProcSamples(t *testing.T) {
+	got, err := getProcSamples("../TestFiles/proc/")
+	if err != nil {
+		t.Fatalf("Got error, %v\n", err)
+	}
+
+	pageSize := int64(os.Getpagesize())
+	want := map[int]ProcSample{
+		101: {101, "chromium", "1000", 5000, 600, 12, 25000 * pageSize, 40, 4096, 8192},
+		102: {102, "chromium", "1000", 5100, 350, 8, 15000 * pageSize, 20, 0, 4096},
+		200: {200, "python3", "0", 3000, 1200, 2, 5000 * pageSize, 5, 1024, 0},
+		300: {300, "my) proc", "0", 100, 15, 1, 100 * pageSize, 3, -1, -1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %+v, want %+v", got, want)
+	}
+}
+
+func Test_getProcStats(t *testing.T) {
+	prev := map[int]ProcSample{
+		101: {101, "chromium", "1000", 5000, 600, 12, 1000, 40, 4096, 8192},
+		102: {102, "chromium", "1000", 5100, 350, 8, 2000, 20, 0, 4096},
+		200: {200, "python3", "0", 3000, 1200, 2, 500, 5, -1, -1},
+		300: {300, "sleep", "0", 100, 15, 1, 100, 3, 0, 0},
+	}
+	curr := map[int]ProcSample{
+		101: {101, "chromium", "1000", 5000, 1600, 12, 1000, 40, 14336, 8192},
+		102: {102, "chromium", "1000", 5100, 850, 8, 2000, 20, 0, 24576},
+		200: {200, "python3", "0", 3000, 1400, 2, 500, 5, -1, -1},
+		// PID was reused by a new process
+		300: {300, "sleep", "0", 9000, 5000, 1, 100, 3, 0, 0},
+	}
+
+	got := getProcStats(prev, curr, 10*time.Second)
+	want := []ProcStats{
+		{Name: "chromium", User: lookupUser("1000"), Processes: 2, CPUPercent: 150, RSS: 3000, Threads: 20, FDs: 60,
+			ReadBytesPerSec: 1024, WriteBytesPerSec: 2048},
+		{Name: "python3", User: lookupUser("0"), Processes: 1, CPUPercent: 20, RSS: 500, Threads: 2, FDs: 5},
+		{Name: "sleep", User: lookupUser("0"), Processes: 1, RSS: 100, Threads: 1, FDs: 3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %+v, want %+v", got, want)
+	}
+}
+
+func Test_selectProcStats(t *testing.T) {
+	stats := []ProcStats{
+		{Name: "chromium", CPUPercent: 150, RSS: 3000},
+		{Name: "kworker", CPUPercent: 0, RSS: 0},
+		{Name: "python3", CPUPercent: 20, RSS: 500},
+		{Name: "sshd", CPUPercent: 0.5, RSS: 100},
+		{Name: "xorg", CPUPercent: 10, RSS: 4000},
+	}
+
+	var tests = []struct {
+		patterns []string
+		topN     int
+		want     []string
+	}{
+		{[]string{}, 1, []string{"chromium", "xorg"}},
+		{[]string{"ssh*"}, 1, []string{"chromium", "sshd", "xorg"}},
+		{[]string{"re:^kw"}, 0, []string{"kworker"}},
+		{[]string{}, 10, []string{"chromium", "kworker", "python3", "sshd", "xorg"}},
+	}
+
+	defer func() {
+		ProcNamePatterns = []string{}
+		ProcTopN = 5
+	}()
+
+	for i, tt := range tests {
+		testname := fmt.Sprintf("%d", i)
+		t.Run(testname, func(t *testing.T) {
+			ProcNamePatterns = tt.patterns
+			ProcTopN = tt.topN
+
+			var got []string
+			for _, elem := range selectProcStats(stats) {
+				got = append(got, elem.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
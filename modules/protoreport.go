@@ -0,0 +1,244 @@
+package modules
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dpinato/pi-reporter/helper"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+const DefaultProtoReportTime = 30 * time.Second
+const BaseProcNetDir = "/proc/net/"
+const ProtoMeasurementsName = "protocol_stats"
+const TCPConnMeasurementsName = "tcp_connections"
+
+// ProtoStatsList are the counters reported from snmp, snmp6 and netstat, named like nstat does,
+// i.e. the protocol followed by the name of the counter
+var ProtoStatsList = []string{
+	"TcpActiveOpens", "TcpPassiveOpens", "TcpAttemptFails", "TcpEstabResets", "TcpCurrEstab",
+	"TcpInSegs", "TcpOutSegs", "TcpRetransSegs", "TcpInErrs", "TcpOutRsts", "TcpInCsumErrors",
+	"UdpInDatagrams", "UdpNoPorts", "UdpInErrors", "UdpOutDatagrams", "UdpRcvbufErrors", "UdpSndbufErrors",
+	"Udp6InDatagrams", "Udp6NoPorts", "Udp6InErrors", "Udp6OutDatagrams", "Udp6RcvbufErrors", "Udp6SndbufErrors",
+	"TcpExtListenOverflows", "TcpExtListenDrops", "TcpExtTCPTimeouts", "TcpExtTCPLostRetransmit",
+	"TcpExtTCPSynRetrans", "TcpExtTCPAbortOnTimeout", "TcpExtTCPAbortOnData", "TcpExtTCPAbortOnClose",
+	"TcpExtTCPAbortOnMemory", "TcpExtTCPBacklogDrop", "TcpExtTCPRcvQDrop",
+	"IpInReceives", "IpInDiscards", "IpOutDiscards", "IpOutNoRoutes", "Ip6InReceives", "Ip6InDiscards",
+}
+
+// TCPStates maps the st column of /proc/net/tcp to the name of the state
+var TCPStates = map[string]string{
+	"01": "established",
+	"02": "syn_sent",
+	"03": "syn_recv",
+	"04": "fin_wait1",
+	"05": "fin_wait2",
+	"06": "time_wait",
+	"07": "close",
+	"08": "close_wait",
+	"09": "last_ack",
+	"0A": "listen",
+	"0B": "closing",
+	"0C": "new_syn_recv",
+}
+
+func ReportProtoStats(dbName, piName string, c client.Client) error {
+	log.Printf("ReportProtoStats() is starting, %s\n", piName)
+
+	ticker := time.NewTicker(DefaultProtoReportTime)
+	for {
+		select {
+		case t := <-ticker.C:
+			stats, err := getProtoStats(BaseProcNetDir)
+			if err != nil {
+				log.Println(err)
+			} else {
+				err = reportProtoStatsToInflux(dbName, piName, ProtoMeasurementsName, stats, t, c)
+				if err != nil {
+					log.Println(err)
+				}
+			}
+
+			states, err := getTCPConnStates(BaseProcNetDir)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			err = reportProtoStatsToInflux(dbName, piName, TCPConnMeasurementsName, states, t, c)
+			if err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+func getProtoStats(baseDir string) (map[string]int64, error) {
+	// read the counters in ProtoStatsList and the socket counts from baseDir, normally /proc/net/
+	// snmp6 is missing when IPv6 is disabled
+	all := make(map[string]int64)
+
+	data, err := ioutil.ReadFile(filepath.Join(baseDir, "snmp"))
+	if err != nil {
+		return nil, err
+	}
+	err = getSnmpStatsFromString(string(data), all)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = ioutil.ReadFile(filepath.Join(baseDir, "netstat"))
+	if err == nil {
+		err = getSnmpStatsFromString(string(data), all)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	data, err = ioutil.ReadFile(filepath.Join(baseDir, "snmp6"))
+	if err == nil {
+		getSnmp6StatsFromString(string(data), all)
+	}
+
+	output := make(map[string]int64)
+	for _, elem := range ProtoStatsList {
+		if v, ok := all[elem]; ok {
+			output[elem] = v
+		}
+	}
+
+	data, err = ioutil.ReadFile(filepath.Join(baseDir, "sockstat"))
+	if err == nil {
+		getSockstatFromString(string(data), output)
+	}
+	data, err = ioutil.ReadFile(filepath.Join(baseDir, "sockstat6"))
+	if err == nil {
+		getSockstatFromString(string(data), output)
+	}
+
+	return output, nil
+}
+
+func getSnmpStatsFromString(data string, output map[string]int64) error {
+	// snmp and netstat have pairs of lines, the first with the names of the counters and
+	// the second with their values, both starting with the protocol
+	// Tcp: RtoAlgorithm RtoMin RtoMax MaxConn ActiveOpens ...
+	// Tcp: 1 200 120000 -1 2718 ...
+	lines := strings.Split(strings.TrimSpace(data), "\n")
+	for i := 0; i+1 < len(lines); i += 2 {
+		names := strings.Fields(lines[i])
+		values := strings.Fields(lines[i+1])
+		if len(names) != len(values) || len(names) == 0 || names[0] != values[0] {
+			return fmt.Errorf("unexpected format, %s", lines[i])
+		}
+
+		proto := strings.TrimSuffix(names[0], ":")
+		for j := 1; j < len(names); j++ {
+			v, err := strconv.ParseInt(values[j], 10, 64)
+			if err != nil {
+				continue
+			}
+			output[proto+names[j]] = v
+		}
+	}
+
+	return nil
+}
+
+func getSnmp6StatsFromString(data string, output map[string]int64) {
+	// snmp6 has one counter per line, e.g. Udp6InErrors    0
+	for _, line := range strings.Split(data, "\n") {
+		list := strings.Fields(line)
+		if len(list) != 2 {
+			continue
+		}
+
+		v, err := strconv.ParseInt(list[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		output[list[0]] = v
+	}
+}
+
+func getSockstatFromString(data string, output map[string]int64) {
+	// sockstat has one line per protocol followed by pairs of names and values, e.g.
+	// TCP: inuse 4 orphan 0 tw 0 alloc 4 mem 0
+	for _, line := range strings.Split(data, "\n") {
+		list := strings.Fields(line)
+		if len(list) < 3 {
+			continue
+		}
+
+		proto := strings.ToLower(strings.TrimSuffix(list[0], ":"))
+		for i := 1; i+1 < len(list); i += 2 {
+			v, err := strconv.ParseInt(list[i+1], 10, 64)
+			if err != nil {
+				continue
+			}
+			output["sockstat_"+proto+"_"+list[i]] = v
+		}
+	}
+}
+
+func getTCPConnStates(baseDir string) (map[string]int64, error) {
+	// count the IPv4 and IPv6 TCP sockets in each state
+	output := make(map[string]int64)
+	for _, name := range TCPStates {
+		output[name] = 0
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(baseDir, "tcp"))
+	if err != nil {
+		return nil, err
+	}
+	countTCPConnStates(string(data), output)
+
+	data, err = ioutil.ReadFile(filepath.Join(baseDir, "tcp6"))
+	if err == nil {
+		countTCPConnStates(string(data), output)
+	}
+
+	return output, nil
+}
+
+func countTCPConnStates(data string, output map[string]int64) {
+	// the first line is a header, the state is the fourth column
+	for i, line := range strings.Split(data, "\n") {
+		list := strings.Fields(line)
+		if i == 0 || len(list) < 4 {
+			continue
+		}
+
+		if name, ok := TCPStates[strings.ToUpper(list[3])]; ok {
+			output[name]++
+		}
+	}
+}
+
+func reportProtoStatsToInflux(dbName, piName, measName string, stats map[string]int64, now time.Time, c client.Client) error {
+	tags := map[string]string{
+		"pi_name": piName,
+	}
+	fields := map[string]interface{}{}
+	for k, v := range stats {
+		fields[k] = v
+	}
+
+	var dbInfoObj helper.DBInfo
+	dbInfoObj.DBName = dbName
+	dbInfoObj.MeasName = measName
+	dbInfoObj.Tags = tags
+	dbInfoObj.Fields = fields
+	dbInfoObj.Now = now
+
+	err := helper.ReportStatsToInflux(dbInfoObj, c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
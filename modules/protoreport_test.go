@@ -0,0 +1,64 @@
+package modules
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_getProtoStats(t *testing.T) {
+	got, err := getProtoStats("../TestFiles/proc_net/")
+	if err != nil {
+		t.Fatalf("Got error, %v\n", err)
+	}
+
+	want := map[string]int64{
+		"TcpActiveOpens": 2718, "TcpPassiveOpens": 341, "TcpAttemptFails": 52, "TcpEstabResets": 78,
+		"TcpCurrEstab": 6, "TcpInSegs": 1410023, "TcpOutSegs": 1376122, "TcpRetransSegs": 1843,
+		"TcpInErrs": 3, "TcpOutRsts": 1201, "TcpInCsumErrors": 0,
+		"UdpInDatagrams": 98310, "UdpNoPorts": 41, "UdpInErrors": 7, "UdpOutDatagrams": 99012,
+		"UdpRcvbufErrors": 5, "UdpSndbufErrors": 0,
+		"Udp6InDatagrams": 310, "Udp6NoPorts": 2, "Udp6InErrors": 0, "Udp6RcvbufErrors": 4,
+		"TcpExtListenOverflows": 12, "TcpExtListenDrops": 14, "TcpExtTCPTimeouts": 233,
+		"TcpExtTCPLostRetransmit": 8, "TcpExtTCPSynRetrans": 97,
+		"IpInReceives": 1520340, "IpInDiscards": 5, "IpOutDiscards": 1, "IpOutNoRoutes": 12,
+		"Ip6InReceives": 3021, "Ip6InDiscards": 1,
+		"sockstat_sockets_used": 212, "sockstat_tcp_inuse": 7, "sockstat_tcp_orphan": 0, "sockstat_tcp_tw": 3,
+		"sockstat_tcp_alloc": 9, "sockstat_tcp_mem": 2, "sockstat_udp_inuse": 4, "sockstat_udp_mem": 3,
+		"sockstat_udplite_inuse": 0, "sockstat_raw_inuse": 0, "sockstat_frag_inuse": 0, "sockstat_frag_memory": 0,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+}
+
+func Test_getSnmpStatsFromString(t *testing.T) {
+	got := make(map[string]int64)
+	err := getSnmpStatsFromString("Tcp: RtoAlgorithm MaxConn\nTcp: 1 -1\n", got)
+	if err != nil {
+		t.Fatalf("Got error, %v\n", err)
+	}
+	want := map[string]int64{"TcpRtoAlgorithm": 1, "TcpMaxConn": -1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+
+	err = getSnmpStatsFromString("Tcp: RtoAlgorithm MaxConn\nUdp: 1 -1\n", got)
+	if err == nil {
+		t.Errorf("Expected error for mismatched lines")
+	}
+}
+
+func Test_getTCPConnStates(t *testing.T) {
+	got, err := getTCPConnStates("../TestFiles/proc_net/")
+	if err != nil {
+		t.Fatalf("Got error, %v\n", err)
+	}
+
+	want := map[string]int64{
+		"established": 2, "syn_sent": 0, "syn_recv": 0, "fin_wait1": 0, "fin_wait2": 0, "time_wait": 1,
+		"close": 0, "close_wait": 1, "last_ack": 0, "listen": 3, "closing": 0, "new_syn_recv": 0,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,157 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dpinato/pi-reporter/helper"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+const DefaultPSIReportTime = 30 * time.Second
+const BasePSIDir = "/proc/pressure/"
+const PSIMeasurementsName = "pressure"
+
+// PSIResources are the resources read from BasePSIDir
+var PSIResources = []string{"cpu", "memory", "io"}
+
+// PSIStats contains one line of a /proc/pressure file
+// https://www.kernel.org/doc/html/latest/accounting/psi.html
+type PSIStats struct {
+	Resource string  // cpu, memory or io
+	Type     string  // some or full
+	Avg10    float64 // percentage of time stalled over the last 10 seconds
+	Avg60    float64
+	Avg300   float64
+	Total    int64 // total time stalled (us)
+}
+
+func ReportPSIStats(dbName, piName string, c client.Client) error {
+	log.Printf("ReportPSIStats() is starting, %s\n", piName)
+
+	// kernels built without CONFIG_PSI, or booted with psi=0, do not have these files
+	_, err := getPSIStats(BasePSIDir)
+	if err != nil {
+		log.Printf("ReportPSIStats() is disabled, %v\n", err)
+		return err
+	}
+
+	ticker := time.NewTicker(DefaultPSIReportTime)
+	for {
+		select {
+		case t := <-ticker.C:
+			stats, err := getPSIStats(BasePSIDir)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+
+			for _, elem := range stats {
+				err = reportPSIStatsToInflux(dbName, piName, elem, t, c)
+				if err != nil {
+					log.Println(err)
+				}
+			}
+		}
+	}
+}
+
+func getPSIStats(baseDir string) ([]PSIStats, error) {
+	// read the pressure of every resource in PSIResources, resources that are missing are skipped
+	var output []PSIStats
+	for _, resource := range PSIResources {
+		data, err := ioutil.ReadFile(filepath.Join(baseDir, resource))
+		if err != nil {
+			continue
+		}
+
+		for _, line := range strings.Split(string(data), "\n") {
+			if len(line) == 0 {
+				continue
+			}
+
+			stat, err := getPSIStatsFromLine(line)
+			if err != nil {
+				log.Printf("Could not parse %s pressure, %v\n", resource, err)
+				continue
+			}
+			stat.Resource = resource
+			output = append(output, stat)
+		}
+	}
+
+	if len(output) == 0 {
+		return nil, errors.New("pressure stall information is not available")
+	}
+	return output, nil
+}
+
+func getPSIStatsFromLine(line string) (PSIStats, error) {
+	// given a line like "some avg10=0.00 avg60=0.00 avg300=0.00 total=0", return its values
+	var stat PSIStats
+	list := strings.Fields(line)
+	if len(list) != 5 || (list[0] != "some" && list[0] != "full") {
+		return stat, fmt.Errorf("unexpected format, %s", line)
+	}
+	stat.Type = list[0]
+
+	for _, elem := range list[1:] {
+		pos := strings.Index(elem, "=")
+		if pos == -1 {
+			return stat, fmt.Errorf("unexpected format, %s", line)
+		}
+
+		var err error
+		key, value := elem[0:pos], elem[pos+1:]
+		switch key {
+		case "avg10":
+			stat.Avg10, err = strconv.ParseFloat(value, 64)
+		case "avg60":
+			stat.Avg60, err = strconv.ParseFloat(value, 64)
+		case "avg300":
+			stat.Avg300, err = strconv.ParseFloat(value, 64)
+		case "total":
+			stat.Total, err = strconv.ParseInt(value, 10, 64)
+		default:
+			err = fmt.Errorf("unexpected key %s", key)
+		}
+		if err != nil {
+			return stat, err
+		}
+	}
+
+	return stat, nil
+}
+
+func reportPSIStatsToInflux(dbName, piName string, stat PSIStats, now time.Time, c client.Client) error {
+	tags := map[string]string{
+		"pi_name":  piName,
+		"resource": stat.Resource,
+		"type":     stat.Type,
+	}
+	fields := map[string]interface{}{
+		"avg10":  stat.Avg10,
+		"avg60":  stat.Avg60,
+		"avg300": stat.Avg300,
+		"total":  stat.Total,
+	}
+
+	var dbInfoObj helper.DBInfo
+	dbInfoObj.DBName = dbName
+	dbInfoObj.MeasName = PSIMeasurementsName
+	dbInfoObj.Tags = tags
+	dbInfoObj.Fields = fields
+	dbInfoObj.Now = now
+
+	err := helper.ReportStatsToInflux(dbInfoObj, c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package modules
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func Test_getPSIStats(t *testing.T) {
+	// io is missing from the sample directory
+	got, err := getPSIStats("../TestFiles/pressure/")
+	if err != nil {
+		t.Fatalf("Got error, %v\n", err)
+	}
+
+	want := []PSIStats{
+		{"cpu", "some", 2.14, 1.48, 1.71, 14827438},
+		{"cpu", "full", 0, 0, 0, 0},
+		{"memory", "some", 0.5, 0.25, 0.1, 123456},
+		{"memory", "full", 0.3, 0.2, 0.05, 65432},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %+v, want %+v", got, want)
+	}
+
+	_, err = getPSIStats("../TestFiles/does_not_exist/")
+	if err == nil {
+		t.Errorf("Expected error when PSI is not available")
+	}
+}
+
+func Test_getPSIStatsFromLine(t *testing.T) {
+	var tests = []struct {
+		line    string
+		want    PSIStats
+		wantErr bool
+	}{
+		{"some avg10=12.50 avg60=3.00 avg300=0.75 total=987654",
+			PSIStats{Type: "some", Avg10: 12.5, Avg60: 3, Avg300: 0.75, Total: 987654}, false},
+		{"full avg10=0.00 avg60=0.00 avg300=0.00 total=0", PSIStats{Type: "full"}, false},
+		{"some avg10=0.00 avg60=0.00 total=0", PSIStats{}, true},
+		{"other avg10=0.00 avg60=0.00 avg300=0.00 total=0", PSIStats{}, true},
+		{"some avg10=x avg60=0.00 avg300=0.00 total=0", PSIStats{}, true},
+	}
+
+	for i, tt := range tests {
+		testname := fmt.Sprintf("%d", i)
+		t.Run(testname, func(t *testing.T) {
+			got, err := getPSIStatsFromLine(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("Got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
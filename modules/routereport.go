@@ -0,0 +1,448 @@
+package modules
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dpinato/pi-reporter/helper"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+const DefaultRouteReportTime = 30 * time.Second
+const RouteMeasurementsName = "default_route"
+const RouteEventsMeasurementsName = "route_events"
+
+// flags of the routes in /proc/net/route and /proc/net/ipv6_route
+const (
+	RTFUp      = 0x0001
+	RTFGateway = 0x0002
+	RTFReject  = 0x0200
+)
+
+// ATFComplete is set in the flags of /proc/net/arp when the MAC address of the neighbour is known
+const ATFComplete = 0x2
+
+// types of route event
+const (
+	RouteEventDefaultRoute = "default_route_changed"
+	RouteEventAddress      = "address_changed"
+)
+
+// RouteWANTargets are probed to tell whether the internet is reachable through the default route,
+// WAN reachability is not reported when empty
+var RouteWANTargets = []ProbeTarget{}
+
+// DefaultRoute is the default route of one address family
+type DefaultRoute struct {
+	Family  string // ipv4 or ipv6
+	IfName  string
+	Gateway string // empty for point-to-point links without a gateway
+	Metric  int64
+}
+
+// RouteEvent describes a change of the default route or of the addresses of an interface
+type RouteEvent struct {
+	Type    string
+	Subject string // the address family for default routes, the interface for addresses
+	Old     string
+	New     string
+}
+
+func ReportRouteStats(dbName, piName string, c client.Client) error {
+	log.Printf("ReportRouteStats() is starting, %s\n", piName)
+
+	// the gateway is only pinged when unprivileged ICMP sockets are allowed
+	icmpAvailable := true
+	conn, err := newICMPConn()
+	if err != nil {
+		log.Printf("%v, the gateway will not be pinged\n", err)
+		icmpAvailable = false
+	} else {
+		conn.Close()
+	}
+
+	// events are reported against the previous sample, nothing is reported for the first one
+	var prevRoutes map[string]DefaultRoute
+	var prevAddrs map[string][]string
+
+	ticker := time.NewTicker(DefaultRouteReportTime)
+	for {
+		select {
+		case t := <-ticker.C:
+			routes, err := getDefaultRoutes(BaseProcNetDir)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			addrs, err := getIfAddresses()
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+
+			if prevRoutes != nil {
+				events := getRouteChanges(prevRoutes, routes)
+				events = append(events, getIfAddrChanges(prevAddrs, addrs)...)
+				for _, elem := range events {
+					log.Printf("%s %s: %s -> %s\n", elem.Type, elem.Subject, elem.Old, elem.New)
+					err = reportRouteEventToInflux(dbName, piName, elem, t, c)
+					if err != nil {
+						log.Println(err)
+					}
+				}
+			}
+			prevRoutes = routes
+			prevAddrs = addrs
+
+			arpData, err := ioutil.ReadFile(filepath.Join(BaseProcNetDir, "arp"))
+			if err != nil {
+				log.Println(err)
+			}
+			for _, family := range []string{"ipv4", "ipv6"} {
+				fields := getRouteFields(routes, family, string(arpData), icmpAvailable)
+				err = reportRouteStatsToInflux(dbName, piName, family, fields, t, c)
+				if err != nil {
+					log.Println(err)
+				}
+			}
+		}
+	}
+}
+
+func getRouteFields(routes map[string]DefaultRoute, family, arpData string, icmpAvailable bool) map[string]interface{} {
+	// describe the default route of the family and whether its gateway and the WAN answer
+	route, ok := routes[family]
+	fields := map[string]interface{}{
+		"has_default_route": ok,
+	}
+	if !ok {
+		return fields
+	}
+
+	fields["if_name"] = route.IfName
+	fields["gateway"] = route.Gateway
+	fields["metric"] = route.Metric
+
+	// the gateway and the WAN targets are probed at the same time, each ICMP probe may take up to
+	// ProbeICMPCount*ProbeTimeout and probing them in turn would take longer than DefaultRouteReportTime
+	// when the network is down
+	var gateway ProbeResult
+	var wg sync.WaitGroup
+	probeGateway := family == "ipv4" && route.Gateway != "" && icmpAvailable
+	if probeGateway {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gateway = runProbe(ProbeTarget{ProbeICMP, route.Gateway})
+		}()
+	}
+
+	if family == "ipv4" && len(RouteWANTargets) > 0 {
+		// the WAN is reachable when any of the targets answers
+		result, ok := runProbesUntilSuccess(RouteWANTargets)
+		fields["wan_reachable"] = ok
+		if ok {
+			fields["wan_latency_ms"] = float64(result.Latency) / float64(time.Millisecond)
+		}
+	}
+
+	// ARP and ping only cover IPv4 gateways, the IPv6 neighbour cache is not exposed in /proc
+	if family == "ipv4" && route.Gateway != "" {
+		fields["gateway_arp_resolved"] = isARPResolved(arpData, route.Gateway, route.IfName)
+	}
+	wg.Wait()
+	if probeGateway {
+		fields["gateway_reachable"] = gateway.Success
+		if gateway.Success {
+			fields["gateway_latency_ms"] = float64(gateway.Latency) / float64(time.Millisecond)
+		}
+	}
+
+	return fields
+}
+
+func runProbesUntilSuccess(targets []ProbeTarget) (ProbeResult, bool) {
+	// probe the targets at the same time and return the first one that answers, the probes still
+	// running finish in the background
+	results := make(chan ProbeResult, len(targets))
+	for _, target := range targets {
+		go func(target ProbeTarget) {
+			results <- runProbe(target)
+		}(target)
+	}
+
+	for range targets {
+		result := <-results
+		if result.Success {
+			return result, true
+		}
+	}
+	return ProbeResult{}, false
+}
+
+func getDefaultRoutes(baseDir string) (map[string]DefaultRoute, error) {
+	// return the default route with the lowest metric of each family, from baseDir (normally /proc/net/)
+	// ipv6_route is missing when IPv6 is disabled
+	data, err := ioutil.ReadFile(filepath.Join(baseDir, "route"))
+	if err != nil {
+		return nil, err
+	}
+	routes := getIPv4DefaultRoutesFromString(string(data))
+
+	data, err = ioutil.ReadFile(filepath.Join(baseDir, "ipv6_route"))
+	if err == nil {
+		routes = append(routes, getIPv6DefaultRoutesFromString(string(data))...)
+	}
+
+	output := make(map[string]DefaultRoute)
+	for _, elem := range routes {
+		best, ok := output[elem.Family]
+		if !ok || elem.Metric < best.Metric {
+			output[elem.Family] = elem
+		}
+	}
+
+	return output, nil
+}
+
+func getIPv4DefaultRoutesFromString(data string) []DefaultRoute {
+	// the first line is a header, addresses are in hex with the bytes in host (little endian) order
+	// Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+	// eth0	00000000	0100A8C0	0003	0	0	202	00000000	0	0	0
+	var output []DefaultRoute
+	for i, line := range strings.Split(data, "\n") {
+		list := strings.Fields(line)
+		if i == 0 || len(list) < 8 {
+			continue
+		}
+
+		flags, err := strconv.ParseInt(list[3], 16, 64)
+		if err != nil || flags&RTFUp == 0 || flags&RTFReject != 0 {
+			continue
+		}
+		if list[1] != "00000000" || list[7] != "00000000" {
+			continue
+		}
+
+		route := DefaultRoute{Family: "ipv4", IfName: list[0]}
+		route.Metric, _ = strconv.ParseInt(list[6], 10, 64)
+		if flags&RTFGateway != 0 {
+			route.Gateway, err = parseProcIPv4(list[2])
+			if err != nil {
+				continue
+			}
+		}
+		output = append(output, route)
+	}
+
+	return output
+}
+
+func getIPv6DefaultRoutesFromString(data string) []DefaultRoute {
+	// there is no header, the columns are destination, prefix length, source, prefix length,
+	// next hop, metric, reference count, use count, flags and interface, all in hex
+	var output []DefaultRoute
+	for _, line := range strings.Split(data, "\n") {
+		list := strings.Fields(line)
+		if len(list) < 10 || list[9] == "lo" {
+			continue
+		}
+
+		flags, err := strconv.ParseInt(list[8], 16, 64)
+		if err != nil || flags&RTFUp == 0 || flags&RTFReject != 0 {
+			continue
+		}
+		if list[1] != "00" || strings.Trim(list[0], "0") != "" {
+			continue
+		}
+
+		route := DefaultRoute{Family: "ipv6", IfName: list[9]}
+		route.Metric, _ = strconv.ParseInt(list[5], 16, 64)
+		if strings.Trim(list[4], "0") != "" {
+			ip, err := hex.DecodeString(list[4])
+			if err != nil || len(ip) != net.IPv6len {
+				continue
+			}
+			route.Gateway = net.IP(ip).String()
+		}
+		output = append(output, route)
+	}
+
+	return output
+}
+
+func parseProcIPv4(value string) (string, error) {
+	// value is something like 0100A8C0 for 192.168.0.1
+	ip, err := hex.DecodeString(value)
+	if err != nil || len(ip) != net.IPv4len {
+		return "", fmt.Errorf("bad IPv4 address %s", value)
+	}
+	return net.IPv4(ip[3], ip[2], ip[1], ip[0]).String(), nil
+}
+
+func isARPResolved(data, ip, ifName string) bool {
+	// given the content of /proc/net/arp, return true if the MAC address of ip on ifName is known
+	// IP address       HW type     Flags       HW address            Mask     Device
+	// 192.168.0.1      0x1         0x2         dc:a6:32:00:00:01     *        eth0
+	for i, line := range strings.Split(data, "\n") {
+		list := strings.Fields(line)
+		if i == 0 || len(list) < 6 || list[0] != ip || list[5] != ifName {
+			continue
+		}
+
+		flags, err := strconv.ParseInt(strings.TrimPrefix(list[2], "0x"), 16, 64)
+		return err == nil && flags&ATFComplete != 0
+	}
+
+	return false
+}
+
+func getIfAddresses() (map[string][]string, error) {
+	// return the sorted addresses of every interface except loopback
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	output := make(map[string][]string)
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		// an interface may go away after being listed, the others are still reported
+		addrs, err := iface.Addrs()
+		if err != nil {
+			log.Printf("Could not read the addresses of %s, %v\n", iface.Name, err)
+			continue
+		}
+		var list []string
+		for _, addr := range addrs {
+			list = append(list, addr.String())
+		}
+		sort.Strings(list)
+		output[iface.Name] = list
+	}
+
+	return output, nil
+}
+
+func getRouteChanges(prev, curr map[string]DefaultRoute) []RouteEvent {
+	// a default route that appears, goes away or moves to another gateway or interface is a change
+	var output []RouteEvent
+	for _, family := range []string{"ipv4", "ipv6"} {
+		p, pOk := prev[family]
+		n, nOk := curr[family]
+		if pOk == nOk && p.IfName == n.IfName && p.Gateway == n.Gateway {
+			continue
+		}
+
+		output = append(output, RouteEvent{
+			Type:    RouteEventDefaultRoute,
+			Subject: family,
+			Old:     describeDefaultRoute(p, pOk),
+			New:     describeDefaultRoute(n, nOk),
+		})
+	}
+
+	return output
+}
+
+func describeDefaultRoute(route DefaultRoute, ok bool) string {
+	if !ok {
+		return "none"
+	}
+	if route.Gateway == "" {
+		return "dev " + route.IfName
+	}
+	return "via " + route.Gateway + " dev " + route.IfName
+}
+
+func getIfAddrChanges(prev, curr map[string][]string) []RouteEvent {
+	// interfaces are compared by name, in sorted order so the events are stable
+	names := make(map[string]bool)
+	for k := range prev {
+		names[k] = true
+	}
+	for k := range curr {
+		names[k] = true
+	}
+	var sorted []string
+	for k := range names {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var output []RouteEvent
+	for _, name := range sorted {
+		p := strings.Join(prev[name], ",")
+		n := strings.Join(curr[name], ",")
+		if p == n {
+			continue
+		}
+
+		if p == "" {
+			p = "none"
+		}
+		if n == "" {
+			n = "none"
+		}
+		output = append(output, RouteEvent{Type: RouteEventAddress, Subject: name, Old: p, New: n})
+	}
+
+	return output
+}
+
+func reportRouteStatsToInflux(dbName, piName, family string, fields map[string]interface{}, now time.Time, c client.Client) error {
+	tags := map[string]string{
+		"pi_name": piName,
+		"family":  family,
+	}
+
+	var dbInfoObj helper.DBInfo
+	dbInfoObj.DBName = dbName
+	dbInfoObj.MeasName = RouteMeasurementsName
+	dbInfoObj.Tags = tags
+	dbInfoObj.Fields = fields
+	dbInfoObj.Now = now
+
+	err := helper.ReportStatsToInflux(dbInfoObj, c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func reportRouteEventToInflux(dbName, piName string, event RouteEvent, now time.Time, c client.Client) error {
+	tags := map[string]string{
+		"pi_name": piName,
+		"event":   event.Type,
+		"subject": event.Subject,
+	}
+	fields := map[string]interface{}{
+		"old": event.Old,
+		"new": event.New,
+	}
+
+	var dbInfoObj helper.DBInfo
+	dbInfoObj.DBName = dbName
+	dbInfoObj.MeasName = RouteEventsMeasurementsName
+	dbInfoObj.Tags = tags
+	dbInfoObj.Fields = fields
+	dbInfoObj.Now = now
+
+	err := helper.ReportStatsToInflux(dbInfoObj, c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
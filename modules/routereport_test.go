@@ -0,0 +1,120 @@
+package modules
+
+import (
+	"io/ioutil"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func Test_getDefaultRoutes(t *testing.T) {
+	got, err := getDefaultRoutes("../TestFiles/proc_net/")
+	if err != nil {
+		t.Fatalf("Got error, %v\n", err)
+	}
+
+	want := map[string]DefaultRoute{
+		"ipv4": {Family: "ipv4", IfName: "eth0", Gateway: "192.168.0.1", Metric: 202},
+		"ipv6": {Family: "ipv6", IfName: "eth0", Gateway: "fe80::1", Metric: 256},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+}
+
+func Test_isARPResolved(t *testing.T) {
+	data, err := ioutil.ReadFile("../TestFiles/proc_net/arp")
+	if err != nil {
+		t.Fatalf("Could not read sample, %v\n", err)
+	}
+
+	var tests = []struct {
+		ip, ifName string
+		want       bool
+	}{
+		{"192.168.0.1", "eth0", true},
+		{"192.168.1.1", "wlan0", false},
+		{"192.168.0.1", "wlan0", false},
+		{"10.0.0.1", "eth0", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip+"_"+tt.ifName, func(t *testing.T) {
+			if got := isARPResolved(string(data), tt.ip, tt.ifName); got != tt.want {
+				t.Errorf("Got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getRouteChanges(t *testing.T) {
+	eth0 := DefaultRoute{Family: "ipv4", IfName: "eth0", Gateway: "192.168.0.1", Metric: 202}
+	wlan0 := DefaultRoute{Family: "ipv4", IfName: "wlan0", Gateway: "192.168.1.1", Metric: 303}
+
+	got := getRouteChanges(map[string]DefaultRoute{"ipv4": eth0}, map[string]DefaultRoute{"ipv4": wlan0})
+	want := []RouteEvent{{RouteEventDefaultRoute, "ipv4", "via 192.168.0.1 dev eth0", "via 192.168.1.1 dev wlan0"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+
+	// only the metric changed
+	eth0Metric := eth0
+	eth0Metric.Metric = 100
+	got = getRouteChanges(map[string]DefaultRoute{"ipv4": eth0}, map[string]DefaultRoute{"ipv4": eth0Metric})
+	if len(got) != 0 {
+		t.Errorf("Got %v, want no events", got)
+	}
+
+	got = getRouteChanges(map[string]DefaultRoute{"ipv4": eth0}, map[string]DefaultRoute{})
+	want = []RouteEvent{{RouteEventDefaultRoute, "ipv4", "via 192.168.0.1 dev eth0", "none"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+}
+
+func Test_getIfAddrChanges(t *testing.T) {
+	prev := map[string][]string{
+		"eth0":  {"192.168.0.10/24"},
+		"wlan0": {"192.168.1.10/24"},
+	}
+	curr := map[string][]string{
+		"eth0":  {"192.168.0.10/24"},
+		"wlan0": {"192.168.1.20/24", "fe80::1/64"},
+		"usb0":  {"10.0.0.2/24"},
+	}
+
+	got := getIfAddrChanges(prev, curr)
+	want := []RouteEvent{
+		{RouteEventAddress, "usb0", "none", "10.0.0.2/24"},
+		{RouteEventAddress, "wlan0", "192.168.1.10/24", "192.168.1.20/24,fe80::1/64"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+}
+
+func Test_runProbesUntilSuccess(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen, %v\n", err)
+	}
+	defer l.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen, %v\n", err)
+	}
+	closed.Close()
+
+	// any target answering is enough, whatever its position
+	good := ProbeTarget{ProbeTCP, l.Addr().String()}
+	bad := ProbeTarget{ProbeTCP, closed.Addr().String()}
+	got, ok := runProbesUntilSuccess([]ProbeTarget{bad, good})
+	if !ok || got.Target != good {
+		t.Errorf("Got %+v %v, want a success of %v", got, ok, good)
+	}
+
+	_, ok = runProbesUntilSuccess([]ProbeTarget{bad, bad})
+	if ok {
+		t.Errorf("Got a success when no target answers")
+	}
+}
@@ -0,0 +1,25 @@
+package modules
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+func readSysfsInt(path string) (int64, error) {
+	// read a sysfs attribute containing a single integer
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+func readSysfsString(path string) string {
+	// read a sysfs attribute containing a single string, empty when it cannot be read
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,177 @@
+package modules
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dpinato/pi-reporter/helper"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+const DefaultSystemReportTime = 30 * time.Second
+const LoadAvgPath = "/proc/loadavg"
+const UptimePath = "/proc/uptime"
+const SystemMeasurementsName = "system"
+
+// SystemStats contains the load average, uptime and boot time of the system
+type SystemStats struct {
+	Load1        float64
+	Load5        float64
+	Load15       float64
+	RunningTasks int64   // tasks currently runnable
+	TotalTasks   int64   // tasks that exist in the system
+	LastPID      int64   // PID most recently assigned
+	Uptime       float64 // seconds since boot
+	IdleTime     float64 // seconds spent idle by all cores since boot
+	BootTime     int64   // unix time of the boot
+}
+
+func ReportSystemStats(dbName, piName string, c client.Client) error {
+	log.Printf("ReportSystemStats() is starting, %s\n", piName)
+
+	ticker := time.NewTicker(DefaultSystemReportTime)
+	for {
+		select {
+		case t := <-ticker.C:
+			stat, err := getSystemStats()
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+
+			err = reportSystemStatsToInflux(dbName, piName, stat, t, c)
+			if err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+func getSystemStats() (SystemStats, error) {
+	var stats SystemStats
+
+	data, err := ioutil.ReadFile(LoadAvgPath)
+	if err != nil {
+		return stats, err
+	}
+	err = getLoadAvgFromString(string(data), &stats)
+	if err != nil {
+		return stats, err
+	}
+
+	data, err = ioutil.ReadFile(UptimePath)
+	if err != nil {
+		return stats, err
+	}
+	err = getUptimeFromString(string(data), &stats)
+	if err != nil {
+		return stats, err
+	}
+
+	data, err = ioutil.ReadFile(CPUStatsFile)
+	if err != nil {
+		return stats, err
+	}
+	stats.BootTime, err = getBootTime(string(data))
+	return stats, err
+}
+
+func getLoadAvgFromString(data string, stats *SystemStats) error {
+	// /proc/loadavg looks like 0.20 0.18 0.12 1/80 11206
+	list := strings.Fields(data)
+	if len(list) != 5 {
+		return fmt.Errorf("unexpected format of %s, %s", LoadAvgPath, data)
+	}
+
+	var err error
+	stats.Load1, err = strconv.ParseFloat(list[0], 64)
+	if err != nil {
+		return err
+	}
+	stats.Load5, err = strconv.ParseFloat(list[1], 64)
+	if err != nil {
+		return err
+	}
+	stats.Load15, err = strconv.ParseFloat(list[2], 64)
+	if err != nil {
+		return err
+	}
+
+	tasks := strings.Split(list[3], "/")
+	if len(tasks) != 2 {
+		return fmt.Errorf("unexpected format of %s, %s", LoadAvgPath, data)
+	}
+	stats.RunningTasks, err = strconv.ParseInt(tasks[0], 10, 64)
+	if err != nil {
+		return err
+	}
+	stats.TotalTasks, err = strconv.ParseInt(tasks[1], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	stats.LastPID, err = strconv.ParseInt(list[4], 10, 64)
+	return err
+}
+
+func getUptimeFromString(data string, stats *SystemStats) error {
+	// /proc/uptime looks like 350735.47 234388.90
+	list := strings.Fields(data)
+	if len(list) != 2 {
+		return fmt.Errorf("unexpected format of %s, %s", UptimePath, data)
+	}
+
+	var err error
+	stats.Uptime, err = strconv.ParseFloat(list[0], 64)
+	if err != nil {
+		return err
+	}
+	stats.IdleTime, err = strconv.ParseFloat(list[1], 64)
+	return err
+}
+
+func getBootTime(data string) (int64, error) {
+	// given the content of /proc/stat, return the value of the btime line
+	for _, line := range strings.Split(data, "\n") {
+		list := strings.Fields(line)
+		if len(list) == 2 && list[0] == "btime" {
+			return strconv.ParseInt(list[1], 10, 64)
+		}
+	}
+
+	return 0, fmt.Errorf("btime not found in %s", CPUStatsFile)
+}
+
+func reportSystemStatsToInflux(dbName, piName string, stat SystemStats, now time.Time, c client.Client) error {
+	tags := map[string]string{
+		"pi_name": piName,
+	}
+	fields := map[string]interface{}{
+		"load1":         stat.Load1,
+		"load5":         stat.Load5,
+		"load15":        stat.Load15,
+		"running_tasks": stat.RunningTasks,
+		"total_tasks":   stat.TotalTasks,
+		"last_pid":      stat.LastPID,
+		"uptime":        stat.Uptime,
+		"idle_time":     stat.IdleTime,
+		"boot_time":     stat.BootTime,
+	}
+
+	var dbInfoObj helper.DBInfo
+	dbInfoObj.DBName = dbName
+	dbInfoObj.MeasName = SystemMeasurementsName
+	dbInfoObj.Tags = tags
+	dbInfoObj.Fields = fields
+	dbInfoObj.Now = now
+
+	err := helper.ReportStatsToInflux(dbInfoObj, c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package modules
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+)
+
+func Test_getSystemStats(t *testing.T) {
+	t.Run("Read system statistics", func(t *testing.T) {
+		got, err := getSystemStats()
+
+		// check for error
+		if err != nil {
+			t.Errorf("Got error, %v\n", err)
+		}
+
+		// check for impossible values
+		if got.TotalTasks <= 0 || got.Uptime <= 0 || got.BootTime <= 0 {
+			t.Errorf("Retrieved invalid system stats, %+v\n", got)
+		}
+	})
+}
+
+func Test_getLoadAvgFromString(t *testing.T) {
+	var tests = []struct {
+		data    string
+		want    SystemStats
+		wantErr bool
+	}{
+		{"0.20 0.18 0.12 1/80 11206\n",
+			SystemStats{Load1: 0.2, Load5: 0.18, Load15: 0.12, RunningTasks: 1, TotalTasks: 80, LastPID: 11206}, false},
+		{"4.05 2.61 1.33 5/312 28391\n",
+			SystemStats{Load1: 4.05, Load5: 2.61, Load15: 1.33, RunningTasks: 5, TotalTasks: 312, LastPID: 28391}, false},
+		{"0.20 0.18 0.12 80 11206\n", SystemStats{}, true},
+		{"", SystemStats{}, true},
+	}
+
+	for i, tt := range tests {
+		testname := fmt.Sprintf("%d", i)
+		t.Run(testname, func(t *testing.T) {
+			var got SystemStats
+			err := getLoadAvgFromString(tt.data, &got)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("Got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getUptimeFromString(t *testing.T) {
+	var got SystemStats
+	err := getUptimeFromString("350735.47 234388.90\n", &got)
+	if err != nil {
+		t.Fatalf("Got error, %v\n", err)
+	}
+	if got.Uptime != 350735.47 || got.IdleTime != 234388.90 {
+		t.Errorf("Got %+v", got)
+	}
+}
+
+func Test_getBootTime(t *testing.T) {
+	data, err := ioutil.ReadFile("../TestFiles/stat_sample_1.txt")
+	if err != nil {
+		t.Fatalf("Could not read sample file, %v\n", err)
+	}
+
+	got, err := getBootTime(string(data))
+	if err != nil {
+		t.Errorf("Got error, %v\n", err)
+	}
+	if got != 1634567890 {
+		t.Errorf("Got %d, want 1634567890", got)
+	}
+
+	_, err = getBootTime("cpu  10000 500 3000 80000 2000 100 400 0 0 0\n")
+	if err == nil {
+		t.Errorf("Expected error when btime is missing")
+	}
+}
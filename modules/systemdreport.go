@@ -0,0 +1,156 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dpinato/pi-reporter/helper"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+const DefaultSystemdReportTime = 30 * time.Second
+const SystemdMeasurementsName = "systemd_units"
+const SystemdCommandTimeout = 10 * time.Second
+
+// SystemdUnits are the units reported, the collector is disabled when empty
+var SystemdUnits = []string{}
+
+// SystemdProperties are the unit properties requested from systemctl show
+var SystemdProperties = []string{"Id", "LoadState", "ActiveState", "SubState", "NRestarts", "MemoryCurrent"}
+
+// SystemdUnitStats contains the state of one systemd unit
+type SystemdUnitStats struct {
+	Unit          string
+	LoadState     string // e.g. loaded, not-found
+	ActiveState   string // e.g. active, failed
+	SubState      string // e.g. running, dead
+	NRestarts     int64  // automatic restarts since the unit was started, -1 when not available
+	MemoryCurrent int64  // bytes, -1 when memory accounting is disabled
+}
+
+// runSystemctlShow returns the output of systemctl show for the units provided,
+// tests replace it with a fake that returns a sample output
+var runSystemctlShow = func(units []string) (string, error) {
+	args := []string{"show", "--property=" + strings.Join(SystemdProperties, ",")}
+	args = append(args, units...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), SystemdCommandTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "systemctl", args...).Output()
+	return string(out), err
+}
+
+func ReportSystemdStats(dbName, piName string, c client.Client) error {
+	if len(SystemdUnits) == 0 {
+		return errors.New("no systemd units configured")
+	}
+
+	log.Printf("ReportSystemdStats() is starting, %s\n", piName)
+
+	ticker := time.NewTicker(DefaultSystemdReportTime)
+	for {
+		select {
+		case t := <-ticker.C:
+			stats, err := getSystemdStats(SystemdUnits)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+
+			for _, elem := range stats {
+				err = reportSystemdStatsToInflux(dbName, piName, elem, t, c)
+				if err != nil {
+					log.Println(err)
+				}
+			}
+		}
+	}
+}
+
+func getSystemdStats(units []string) ([]SystemdUnitStats, error) {
+	out, err := runSystemctlShow(units)
+	if err != nil {
+		return nil, err
+	}
+	return getSystemdStatsFromString(out), nil
+}
+
+func getSystemdStatsFromString(data string) []SystemdUnitStats {
+	// systemctl show prints one block of key=value lines per unit, separated by empty lines
+	var output []SystemdUnitStats
+	for _, block := range strings.Split(strings.TrimSpace(data), "\n\n") {
+		stats := SystemdUnitStats{NRestarts: -1, MemoryCurrent: -1}
+
+		for _, line := range strings.Split(block, "\n") {
+			pos := strings.Index(line, "=")
+			if pos == -1 {
+				continue
+			}
+
+			key, value := line[0:pos], line[pos+1:]
+			switch key {
+			case "Id":
+				stats.Unit = value
+			case "LoadState":
+				stats.LoadState = value
+			case "ActiveState":
+				stats.ActiveState = value
+			case "SubState":
+				stats.SubState = value
+			case "NRestarts":
+				if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+					stats.NRestarts = v
+				}
+			case "MemoryCurrent":
+				// [not set] or the maximum uint64 when memory accounting is disabled
+				if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+					stats.MemoryCurrent = v
+				}
+			}
+		}
+
+		if stats.Unit != "" {
+			output = append(output, stats)
+		}
+	}
+
+	return output
+}
+
+func reportSystemdStatsToInflux(dbName, piName string, stat SystemdUnitStats, now time.Time, c client.Client) error {
+	tags := map[string]string{
+		"pi_name": piName,
+		"unit":    stat.Unit,
+	}
+	fields := map[string]interface{}{
+		"load_state":   stat.LoadState,
+		"active_state": stat.ActiveState,
+		"sub_state":    stat.SubState,
+		"active":       stat.ActiveState == "active",
+		"failed":       stat.ActiveState == "failed",
+	}
+	if stat.NRestarts >= 0 {
+		fields["restarts"] = stat.NRestarts
+	}
+	if stat.MemoryCurrent >= 0 {
+		fields["memory_current"] = stat.MemoryCurrent
+	}
+
+	var dbInfoObj helper.DBInfo
+	dbInfoObj.DBName = dbName
+	dbInfoObj.MeasName = SystemdMeasurementsName
+	dbInfoObj.Tags = tags
+	dbInfoObj.Fields = fields
+	dbInfoObj.Now = now
+
+	err := helper.ReportStatsToInflux(dbInfoObj, c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package modules
+
+import (
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func Test_getSystemdStats(t *testing.T) {
+	sample, err := ioutil.ReadFile("../TestFiles/systemctl_show_sample.txt")
+	if err != nil {
+		t.Fatalf("Could not read sample file, %v\n", err)
+	}
+
+	var gotUnits []string
+	origRunner := runSystemctlShow
+	runSystemctlShow = func(units []string) (string, error) {
+		gotUnits = units
+		return string(sample), nil
+	}
+	defer func() { runSystemctlShow = origRunner }()
+
+	units := []string{"kiosk.service", "openvpn.service", "sensors.timer", "missing.service"}
+	got, err := getSystemdStats(units)
+	if err != nil {
+		t.Fatalf("Got error, %v\n", err)
+	}
+	if !reflect.DeepEqual(gotUnits, units) {
+		t.Errorf("systemctl called with %v, want %v", gotUnits, units)
+	}
+
+	want := []SystemdUnitStats{
+		{"kiosk.service", "loaded", "active", "running", 3, 157286400},
+		{"openvpn.service", "loaded", "failed", "failed", 0, -1},
+		{"sensors.timer", "loaded", "active", "waiting", -1, -1},
+		{"missing.service", "not-found", "inactive", "dead", 0, -1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %+v, want %+v", got, want)
+	}
+}
+
+func Test_getSystemdStatsError(t *testing.T) {
+	origRunner := runSystemctlShow
+	runSystemctlShow = func(units []string) (string, error) {
+		return "", errors.New("systemctl not found")
+	}
+	defer func() { runSystemctlShow = origRunner }()
+
+	_, err := getSystemdStats([]string{"kiosk.service"})
+	if err == nil {
+		t.Errorf("Expected error when systemctl fails")
+	}
+}
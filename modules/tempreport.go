@@ -3,7 +3,7 @@ package modules
 import (
 	"io/ioutil"
 	"log"
-	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -15,18 +15,42 @@ import (
 const DefaultTempReportTime = 30 * time.Second
 const TempStatsPath = "/sys/class/thermal/thermal_zone0/temp"
 const TempMeasurementsName = "temperature_stats"
+const BaseThermalDir = "/sys/class/thermal/"
+const BaseHwmonDir = "/sys/class/hwmon/"
+const ThermalZoneMeasurementsName = "thermal_zone_stats"
+const HwmonMeasurementsName = "hwmon_stats"
 
-func ReportTempStats(dbName string, c client.Client) error {
-	myName, _ := helper.GetPIName(helper.PINetIfaces[0])
-	hostname, err := os.Hostname()
-	if err != nil {
-		log.Printf("Failed to get hostname - %+v", err)
-		hostname = myName
-	} else if hostname == helper.PIDefaultHostname {
-		hostname = myName
-	}
+// HwmonSensorKinds maps the prefix of hwmon input files to the field reported and the divisor
+// that converts the value to the field unit
+// https://www.kernel.org/doc/Documentation/hwmon/sysfs-interface
+var HwmonSensorKinds = map[string]struct {
+	Field   string
+	Divisor float64
+}{
+	"temp": {"temperature", 1000.0}, // milli-Celsius
+	"fan":  {"fan_rpm", 1.0},        // RPM
+	"in":   {"voltage", 1000.0},     // mV
+}
+
+// ThermalZoneStats contains the temperature and trip points of one thermal zone
+type ThermalZoneStats struct {
+	Zone        string
+	Type        string
+	Temperature float64            // Celsius
+	TripPoints  map[string]float64 // temperature of each trip point (Celsius), e.g. trip_point_0
+	TripTypes   map[string]string  // type of each trip point, e.g. critical
+}
+
+// HwmonSensorStats contains the value of one hwmon sensor input
+type HwmonSensorStats struct {
+	Chip   string // name of the hwmon chip, e.g. cpu_thermal
+	Sensor string // label of the input, or its name when it has no label, e.g. temp1
+	Kind   string // temp, fan or in
+	Value  float64
+}
 
-	log.Printf("ReportTempStats() is starting, %s\n", hostname)
+func ReportTempStats(dbName, piName string, c client.Client) error {
+	log.Printf("ReportTempStats() is starting, %s\n", piName)
 
 	ticker := time.NewTicker(DefaultTempReportTime)
 	for {
@@ -35,13 +59,34 @@ func ReportTempStats(dbName string, c client.Client) error {
 			stat, err := getPITemperature()
 			if err != nil {
 				log.Println(err)
-				continue
+			} else {
+				err = reportTempStatsToInflux(dbName, piName, stat, t, c)
+				if err != nil {
+					log.Println(err)
+				}
 			}
 
-			err = reportTempStatsToInflux(dbName, hostname, stat, t, c)
+			zones, err := getThermalZoneStats(BaseThermalDir)
 			if err != nil {
 				log.Println(err)
 			}
+			for _, elem := range zones {
+				err = reportThermalZoneStatsToInflux(dbName, piName, elem, t, c)
+				if err != nil {
+					log.Println(err)
+				}
+			}
+
+			sensors, err := getHwmonStats(BaseHwmonDir)
+			if err != nil {
+				log.Println(err)
+			}
+			for _, elem := range sensors {
+				err = reportHwmonStatsToInflux(dbName, piName, elem, t, c)
+				if err != nil {
+					log.Println(err)
+				}
+			}
 		}
 	}
 }
@@ -60,6 +105,97 @@ func getPITemperature() (float64, error) {
 	return (tmpFloat / 1000.0), err
 }
 
+func getThermalZoneStats(baseDir string) ([]ThermalZoneStats, error) {
+	// read every thermal zone in baseDir, normally /sys/class/thermal/
+	zoneDirs, err := filepath.Glob(filepath.Join(baseDir, "thermal_zone*"))
+	if err != nil {
+		return nil, err
+	}
+
+	var output []ThermalZoneStats
+	for _, zoneDir := range zoneDirs {
+		temp, err := readSysfsInt(filepath.Join(zoneDir, "temp"))
+		if err != nil {
+			// zone is disabled or cannot be read
+			continue
+		}
+
+		stats := ThermalZoneStats{
+			Zone:        filepath.Base(zoneDir),
+			Temperature: float64(temp) / 1000.0,
+			TripPoints:  make(map[string]float64),
+			TripTypes:   make(map[string]string),
+		}
+		zoneType, _ := ioutil.ReadFile(filepath.Join(zoneDir, "type"))
+		stats.Type = strings.TrimSpace(string(zoneType))
+
+		tripFiles, _ := filepath.Glob(filepath.Join(zoneDir, "trip_point_*_temp"))
+		for _, tripFile := range tripFiles {
+			tripTemp, err := readSysfsInt(tripFile)
+			if err != nil {
+				continue
+			}
+			tripName := strings.TrimSuffix(filepath.Base(tripFile), "_temp")
+			stats.TripPoints[tripName] = float64(tripTemp) / 1000.0
+
+			tripType, err := ioutil.ReadFile(filepath.Join(zoneDir, tripName+"_type"))
+			if err == nil {
+				stats.TripTypes[tripName] = strings.TrimSpace(string(tripType))
+			}
+		}
+
+		output = append(output, stats)
+	}
+
+	return output, nil
+}
+
+func getHwmonStats(baseDir string) ([]HwmonSensorStats, error) {
+	// read every temperature, fan and voltage input of the hwmon chips in baseDir, normally /sys/class/hwmon/
+	chipDirs, err := filepath.Glob(filepath.Join(baseDir, "hwmon*"))
+	if err != nil {
+		return nil, err
+	}
+
+	var output []HwmonSensorStats
+	for _, chipDir := range chipDirs {
+		chipName, _ := ioutil.ReadFile(filepath.Join(chipDir, "name"))
+		chip := strings.TrimSpace(string(chipName))
+		if chip == "" {
+			chip = filepath.Base(chipDir)
+		}
+
+		inputFiles, _ := filepath.Glob(filepath.Join(chipDir, "*_input"))
+		for _, inputFile := range inputFiles {
+			sensor := strings.TrimSuffix(filepath.Base(inputFile), "_input")
+			kind := strings.TrimRight(sensor, "0123456789")
+			kindInfo, ok := HwmonSensorKinds[kind]
+			if !ok {
+				continue
+			}
+
+			value, err := readSysfsInt(inputFile)
+			if err != nil {
+				continue
+			}
+
+			label, err := ioutil.ReadFile(filepath.Join(chipDir, sensor+"_label"))
+			if err == nil && strings.TrimSpace(string(label)) != "" {
+				sensor = strings.TrimSpace(string(label))
+			}
+
+			output = append(output, HwmonSensorStats{
+				Chip:   chip,
+				Sensor: sensor,
+				Kind:   kind,
+				Value:  float64(value) / kindInfo.Divisor,
+			})
+		}
+	}
+
+	return output, nil
+}
+
 func reportTempStatsToInflux(dbName, piName string, stat float64, now time.Time, c client.Client) error {
 	tags := map[string]string{
 		"pi_name": piName,
@@ -80,3 +216,55 @@ func reportTempStatsToInflux(dbName, piName string, stat float64, now time.Time,
 	}
 	return nil
 }
+
+func reportThermalZoneStatsToInflux(dbName, piName string, stat ThermalZoneStats, now time.Time, c client.Client) error {
+	tags := map[string]string{
+		"pi_name": piName,
+		"zone":    stat.Zone,
+		"type":    stat.Type,
+	}
+	fields := map[string]interface{}{}
+	fields["temperature"] = stat.Temperature
+	for k, v := range stat.TripPoints {
+		fields[k+"_temp"] = v
+	}
+	for k, v := range stat.TripTypes {
+		fields[k+"_type"] = v
+	}
+
+	var dbInfoObj helper.DBInfo
+	dbInfoObj.DBName = dbName
+	dbInfoObj.MeasName = ThermalZoneMeasurementsName
+	dbInfoObj.Tags = tags
+	dbInfoObj.Fields = fields
+	dbInfoObj.Now = now
+
+	err := helper.ReportStatsToInflux(dbInfoObj, c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func reportHwmonStatsToInflux(dbName, piName string, stat HwmonSensorStats, now time.Time, c client.Client) error {
+	tags := map[string]string{
+		"pi_name": piName,
+		"chip":    stat.Chip,
+		"sensor":  stat.Sensor,
+	}
+	fields := map[string]interface{}{}
+	fields[HwmonSensorKinds[stat.Kind].Field] = stat.Value
+
+	var dbInfoObj helper.DBInfo
+	dbInfoObj.DBName = dbName
+	dbInfoObj.MeasName = HwmonMeasurementsName
+	dbInfoObj.Tags = tags
+	dbInfoObj.Fields = fields
+	dbInfoObj.Now = now
+
+	err := helper.ReportStatsToInflux(dbInfoObj, c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -1,6 +1,9 @@
 package modules
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func Test_getPITemperature(t *testing.T) {
 
@@ -18,3 +21,40 @@ func Test_getPITemperature(t *testing.T) {
 		}
 	})
 }
+
+func Test_getThermalZoneStats(t *testing.T) {
+	got, err := getThermalZoneStats("../TestFiles/sys/class/thermal/")
+	if err != nil {
+		t.Fatalf("Got error, %v\n", err)
+	}
+
+	want := []ThermalZoneStats{
+		{Zone: "thermal_zone0", Type: "cpu-thermal", Temperature: 48.312,
+			TripPoints: map[string]float64{"trip_point_0": 110, "trip_point_1": 60},
+			TripTypes:  map[string]string{"trip_point_0": "critical", "trip_point_1": "active"}},
+		{Zone: "thermal_zone1", Type: "poe-fan-thermal", Temperature: 41,
+			TripPoints: map[string]float64{}, TripTypes: map[string]string{}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %+v, want %+v", got, want)
+	}
+}
+
+func Test_getHwmonStats(t *testing.T) {
+	got, err := getHwmonStats("../TestFiles/sys/class/hwmon/")
+	if err != nil {
+		t.Fatalf("Got error, %v\n", err)
+	}
+
+	want := []HwmonSensorStats{
+		{Chip: "cpu_thermal", Sensor: "temp1", Kind: "temp", Value: 48.312},
+		{Chip: "pwmfan", Sensor: "fan1", Kind: "fan", Value: 3012},
+		{Chip: "nvme", Sensor: "Composite", Kind: "temp", Value: 38.85},
+		{Chip: "nvme", Sensor: "Sensor 1", Kind: "temp", Value: 41.85},
+		{Chip: "ina219", Sensor: "in0", Kind: "in", Value: 0.012},
+		{Chip: "ina219", Sensor: "bus", Kind: "in", Value: 5.123},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %+v, want %+v", got, want)
+	}
+}
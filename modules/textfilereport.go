@@ -0,0 +1,271 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dpinato/pi-reporter/helper"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+const DefaultTextfileReportTime = 30 * time.Second
+const TextfileStatusMeasurementsName = "textfile_status"
+
+// extensions of the files read, other files (e.g. temporary files of atomic writes) are ignored
+const (
+	TextfilePrometheusExt   = ".prom" // Prometheus text format, each sample becomes a point with a value field
+	TextfileLineProtocolExt = ".lp"   // InfluxDB line protocol
+)
+
+// TextfileDir is the directory read, the collector is disabled when empty
+var TextfileDir = ""
+
+// TextfileMaxAge is the age after which a file is considered stale and its metrics are not reported
+var TextfileMaxAge = 10 * time.Minute
+
+// TextfileStatus describes the outcome of reading one file
+type TextfileStatus struct {
+	File   string
+	Age    time.Duration // time since the file was last modified
+	Stale  bool
+	Points int
+	Error  string
+}
+
+func ReportTextfileStats(dbName, piName string, c client.Client) error {
+	if TextfileDir == "" {
+		return errors.New("no textfile directory configured")
+	}
+
+	log.Printf("ReportTextfileStats() is starting, %s\n", piName)
+
+	ticker := time.NewTicker(DefaultTextfileReportTime)
+	for {
+		select {
+		case t := <-ticker.C:
+			points, statuses, err := getTextfilePoints(TextfileDir, t)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+
+			// the points of each file are written at once, a file may have hundreds of them
+			pos := 0
+			for i, elem := range statuses {
+				filePoints := points[pos : pos+elem.Points]
+				pos += elem.Points
+				if len(filePoints) == 0 {
+					continue
+				}
+
+				for _, point := range filePoints {
+					point.Tags["pi_name"] = piName
+				}
+				written, err := helper.ReportBatchToInflux(dbName, filePoints, c)
+				if err != nil {
+					statuses[i].Error = err.Error()
+				}
+				statuses[i].Points = written
+			}
+
+			for _, elem := range statuses {
+				if elem.Error != "" {
+					log.Printf("Could not report %s, %s\n", elem.File, elem.Error)
+				}
+				err = reportTextfileStatusToInflux(dbName, piName, elem, t, c)
+				if err != nil {
+					log.Println(err)
+				}
+			}
+		}
+	}
+}
+
+func getTextfilePoints(dir string, now time.Time) ([]helper.DBInfo, []TextfileStatus, error) {
+	// return the points of the files in dir that are not stale, without DBName, and the status of every file
+	// the points are in the order of the statuses, each status has the number of points of its file
+	// a file that cannot be parsed is skipped entirely, so a half written file does not report partial data
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var points []helper.DBInfo
+	var statuses []TextfileStatus
+	for _, elem := range entries {
+		ext := filepath.Ext(elem.Name())
+		if elem.IsDir() || (ext != TextfilePrometheusExt && ext != TextfileLineProtocolExt) {
+			continue
+		}
+
+		status := TextfileStatus{File: elem.Name(), Age: now.Sub(elem.ModTime())}
+		if status.Age > TextfileMaxAge {
+			status.Stale = true
+			statuses = append(statuses, status)
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, elem.Name()))
+		var filePoints []helper.DBInfo
+		if err == nil {
+			if ext == TextfilePrometheusExt {
+				filePoints, err = parsePrometheusText(string(data), now)
+			} else {
+				filePoints, err = parseLineProtocol(string(data), now)
+			}
+		}
+		if err != nil {
+			status.Error = err.Error()
+		} else {
+			status.Points = len(filePoints)
+			points = append(points, filePoints...)
+		}
+		statuses = append(statuses, status)
+	}
+
+	return points, statuses, nil
+}
+
+func parsePrometheusText(data string, now time.Time) ([]helper.DBInfo, error) {
+	// the name of the metric is the measurement, labels are tags and the sample is the value field
+	// http_requests_total{method="post",code="200"} 1027 1395066363000
+	// https://prometheus.io/docs/instrumenting/exposition_formats/#text-based-format
+	var output []helper.DBInfo
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		point, err := parsePrometheusLine(line, now)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		if point.Fields == nil {
+			// NaN and infinite values cannot be stored
+			continue
+		}
+		output = append(output, point)
+	}
+
+	return output, nil
+}
+
+func parsePrometheusLine(line string, now time.Time) (helper.DBInfo, error) {
+	point := helper.DBInfo{Tags: map[string]string{}, Now: now}
+
+	pos := strings.IndexAny(line, "{ \t")
+	if pos <= 0 {
+		return point, fmt.Errorf("missing value, %s", line)
+	}
+	point.MeasName = line[0:pos]
+	rest := line[pos:]
+
+	if rest[0] == '{' {
+		end, err := parsePrometheusLabels(rest, point.Tags)
+		if err != nil {
+			return point, err
+		}
+		rest = rest[end:]
+	}
+
+	list := strings.Fields(rest)
+	if len(list) < 1 || len(list) > 2 {
+		return point, fmt.Errorf("expected a value and an optional timestamp, %s", line)
+	}
+
+	value, err := strconv.ParseFloat(list[0], 64)
+	if err != nil {
+		return point, fmt.Errorf("bad value %s", list[0])
+	}
+	if len(list) == 2 {
+		ms, err := strconv.ParseInt(list[1], 10, 64)
+		if err != nil {
+			return point, fmt.Errorf("bad timestamp %s", list[1])
+		}
+		point.Now = time.Unix(0, ms*int64(time.Millisecond))
+	}
+
+	if !math.IsNaN(value) && !math.IsInf(value, 0) {
+		point.Fields = map[string]interface{}{"value": value}
+	}
+	return point, nil
+}
+
+func parsePrometheusLabels(data string, labels map[string]string) (int, error) {
+	// data starts with {, return the position after the closing }
+	// label values are quoted and may contain the escapes \\, \" and \n
+	i := 1
+	for {
+		for i < len(data) && (data[i] == ' ' || data[i] == ',') {
+			i++
+		}
+		if i < len(data) && data[i] == '}' {
+			return i + 1, nil
+		}
+
+		eq := strings.Index(data[i:], "=")
+		if eq == -1 || i+eq+1 >= len(data) || data[i+eq+1] != '"' {
+			return 0, fmt.Errorf("bad labels, %s", data)
+		}
+		name := strings.TrimSpace(data[i : i+eq])
+		i += eq + 2
+
+		var value strings.Builder
+		for ; i < len(data) && data[i] != '"'; i++ {
+			if data[i] == '\\' && i+1 < len(data) {
+				i++
+				if data[i] == 'n' {
+					value.WriteByte('\n')
+					continue
+				}
+			}
+			value.WriteByte(data[i])
+		}
+		if i >= len(data) {
+			return 0, fmt.Errorf("unterminated label value, %s", data)
+		}
+		i++
+
+		// empty label values are the same as missing labels
+		if v := value.String(); v != "" {
+			labels[name] = v
+		}
+	}
+}
+
+func reportTextfileStatusToInflux(dbName, piName string, status TextfileStatus, now time.Time, c client.Client) error {
+	tags := map[string]string{
+		"pi_name": piName,
+		"file":    status.File,
+	}
+	fields := map[string]interface{}{
+		"age_seconds": status.Age.Seconds(),
+		"stale":       status.Stale,
+		"points":      status.Points,
+		"success":     status.Error == "" && !status.Stale,
+	}
+	if status.Error != "" {
+		fields["error"] = status.Error
+	}
+
+	var dbInfoObj helper.DBInfo
+	dbInfoObj.DBName = dbName
+	dbInfoObj.MeasName = TextfileStatusMeasurementsName
+	dbInfoObj.Tags = tags
+	dbInfoObj.Fields = fields
+	dbInfoObj.Now = now
+
+	err := helper.ReportStatsToInflux(dbInfoObj, c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package modules
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_parsePrometheusText(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	data := `# HELP backup_last_success_timestamp_seconds Time of the last successful backup.
+# TYPE backup_last_success_timestamp_seconds gauge
+backup_last_success_timestamp_seconds 1.5999e+09
+backup_files{job="nightly",path="C:\\data \"main\""} 1027 1395066363000
+rpc_duration_seconds{quantile="0.5", service=""} 4773
+rpc_errors NaN
+`
+	got, err := parsePrometheusText(data, now)
+	if err != nil {
+		t.Fatalf("Got error, %v\n", err)
+	}
+
+	want := []struct {
+		meas   string
+		tags   map[string]string
+		fields map[string]interface{}
+		now    time.Time
+	}{
+		{"backup_last_success_timestamp_seconds", map[string]string{}, map[string]interface{}{"value": 1.5999e+09}, now},
+		{"backup_files", map[string]string{"job": "nightly", "path": `C:\data "main"`},
+			map[string]interface{}{"value": 1027.0}, time.Unix(1395066363, 0)},
+		{"rpc_duration_seconds", map[string]string{"quantile": "0.5"}, map[string]interface{}{"value": 4773.0}, now},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Got %v, want %d points", got, len(want))
+	}
+	for i := range want {
+		if got[i].MeasName != want[i].meas || !reflect.DeepEqual(got[i].Tags, want[i].tags) ||
+			!reflect.DeepEqual(got[i].Fields, want[i].fields) || !got[i].Now.Equal(want[i].now) {
+			t.Errorf("Got %v, want %v", got[i], want[i])
+		}
+	}
+
+	for _, bad := range []string{"metric", `metric{job="x} 1`, "metric abc", `metric{job=x} 1`, "metric 1 2 3"} {
+		if _, err := parsePrometheusText(bad, now); err == nil {
+			t.Errorf("Got no error for %s", bad)
+		}
+	}
+}
+
+func Test_getTextfilePoints(t *testing.T) {
+	dir, err := ioutil.TempDir("", "textfile")
+	if err != nil {
+		t.Fatalf("Could not create directory, %v\n", err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	files := []struct {
+		name, data string
+		age        time.Duration
+	}{
+		{"backup.prom", "backup_ok 1\n", time.Minute},
+		{"garden.lp", "garden,sensor=soil moisture=41.5\ngarden,sensor=air temp=18\n", time.Minute},
+		{"broken.lp", "garden moisture=\n", time.Minute},
+		{"old.prom", "backup_ok 0\n", time.Hour},
+		{"tmp.prom.1234", "backup_ok 0\n", time.Minute},
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, f.name)
+		if err := ioutil.WriteFile(path, []byte(f.data), 0644); err != nil {
+			t.Fatalf("Could not write file, %v\n", err)
+		}
+		mtime := now.Add(-f.age)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatalf("Could not set mtime, %v\n", err)
+		}
+	}
+
+	points, statuses, err := getTextfilePoints(dir, now)
+	if err != nil {
+		t.Fatalf("Got error, %v\n", err)
+	}
+
+	var names []string
+	for _, elem := range points {
+		names = append(names, elem.MeasName)
+	}
+	if want := []string{"backup_ok", "garden", "garden"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Got points %v, want %v", names, want)
+	}
+
+	if len(statuses) != 4 {
+		t.Fatalf("Got %v, want the status of 4 files", statuses)
+	}
+	got := map[string]TextfileStatus{}
+	for _, elem := range statuses {
+		got[elem.File] = elem
+	}
+	if s := got["backup.prom"]; s.Points != 1 || s.Stale || s.Error != "" {
+		t.Errorf("Got %+v for backup.prom", s)
+	}
+	if s := got["garden.lp"]; s.Points != 2 || s.Stale || s.Error != "" {
+		t.Errorf("Got %+v for garden.lp", s)
+	}
+	if s := got["broken.lp"]; s.Points != 0 || s.Error == "" {
+		t.Errorf("Got %+v for broken.lp, want an error", s)
+	}
+	if s := got["old.prom"]; !s.Stale || s.Points != 0 {
+		t.Errorf("Got %+v for old.prom, want it stale", s)
+	}
+}
@@ -0,0 +1,157 @@
+package modules
+
+import (
+	"io/ioutil"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dpinato/pi-reporter/helper"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+const DefaultVMStatReportTime = 30 * time.Second
+const VMStatPath = "/proc/vmstat"
+const VMStatMeasurementsName = "vmstat"
+
+// VMStatList are the counters of /proc/vmstat that are reported as rates per second
+var VMStatList = []string{"pgpgin", "pgpgout", "pswpin", "pswpout", "pgfault", "pgmajfault", "oom_kill",
+	"allocstall", "pgsteal_kswapd", "pgsteal_direct", "pgscan_kswapd", "pgscan_direct",
+	"workingset_refault", "compact_stall"}
+
+// VMStatSums maps counters that newer kernels split by zone or type to the prefix of the counters
+// that are summed to obtain them, e.g. allocstall_normal and allocstall_movable
+var VMStatSums = map[string]string{
+	"allocstall":         "allocstall_",
+	"workingset_refault": "workingset_refault_",
+}
+
+func ReportVMStats(dbName, piName string, c client.Client) error {
+	log.Printf("ReportVMStats() is starting, %s\n", piName)
+
+	// get first sample, rates are computed against the previous sample
+	prevStats, err := getVMStats()
+	if err != nil {
+		log.Println(err)
+	}
+	prevTime := time.Now()
+
+	ticker := time.NewTicker(DefaultVMStatReportTime)
+	for {
+		select {
+		case t := <-ticker.C:
+			stats, err := getVMStats()
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+
+			rates, ok := getVMStatRates(prevStats, stats, t.Sub(prevTime))
+			prevStats = stats
+			prevTime = t
+			if !ok {
+				log.Println("vmstat counters were reset, skipping sample")
+				continue
+			}
+
+			err = reportVMStatsToInflux(dbName, piName, stats, rates, t, c)
+			if err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+func getVMStats() (map[string]int64, error) {
+	data, err := ioutil.ReadFile(VMStatPath)
+	if err != nil {
+		return map[string]int64{}, err
+	}
+	return getVMStatsFromString(string(data)), nil
+}
+
+func getVMStatsFromString(data string) map[string]int64 {
+	// given the content of /proc/vmstat, return the counters in VMStatList
+	wanted := make(map[string]bool)
+	for _, elem := range VMStatList {
+		wanted[elem] = true
+	}
+
+	output := make(map[string]int64)
+	for _, line := range strings.Split(data, "\n") {
+		list := strings.Fields(line)
+		if len(list) != 2 {
+			continue
+		}
+
+		value, err := strconv.ParseInt(list[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		if wanted[list[0]] {
+			output[list[0]] += value
+			continue
+		}
+		for sumName, prefix := range VMStatSums {
+			if wanted[sumName] && strings.HasPrefix(list[0], prefix) {
+				output[sumName] += value
+			}
+		}
+	}
+
+	return output
+}
+
+func getVMStatRates(pStats, nStats map[string]int64, elapsed time.Duration) (map[string]float64, bool) {
+	// pStats is the previous sample, nStats is the latest one
+	// counters missing from either sample are not reported
+	output := make(map[string]float64)
+	if elapsed <= 0 {
+		return output, false
+	}
+
+	for k, curr := range nStats {
+		prev, ok := pStats[k]
+		if !ok {
+			continue
+		}
+
+		// the counters are unsigned longs, so they can wrap on 32 bit kernels
+		d, ok := counterDelta(prev, curr)
+		if !ok {
+			return output, false
+		}
+		output[k] = float64(d) / elapsed.Seconds()
+	}
+
+	return output, true
+}
+
+func reportVMStatsToInflux(dbName, piName string, stats map[string]int64, rates map[string]float64, now time.Time, c client.Client) error {
+	tags := map[string]string{
+		"pi_name": piName,
+	}
+	fields := map[string]interface{}{}
+	for k, v := range rates {
+		fields[k+"_per_sec"] = v
+	}
+	if v, ok := stats["oom_kill"]; ok {
+		// kills are rare enough that the counter itself is easier to alert on
+		fields["oom_kill"] = v
+	}
+
+	var dbInfoObj helper.DBInfo
+	dbInfoObj.DBName = dbName
+	dbInfoObj.MeasName = VMStatMeasurementsName
+	dbInfoObj.Tags = tags
+	dbInfoObj.Fields = fields
+	dbInfoObj.Now = now
+
+	err := helper.ReportStatsToInflux(dbInfoObj, c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
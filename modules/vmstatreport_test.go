@@ -0,0 +1,62 @@
+package modules
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_getVMStatsFromString(t *testing.T) {
+	data, err := ioutil.ReadFile("../TestFiles/vmstat_sample.txt")
+	if err != nil {
+		t.Fatalf("Could not read sample file, %v\n", err)
+	}
+
+	got := getVMStatsFromString(string(data))
+	want := map[string]int64{
+		"pgpgin": 707286, "pgpgout": 213168, "pswpin": 512, "pswpout": 2048,
+		"pgfault": 4271333, "pgmajfault": 308, "oom_kill": 1, "allocstall": 10,
+		"pgsteal_kswapd": 1000, "pgsteal_direct": 20, "pgscan_kswapd": 1500, "pgscan_direct": 30,
+		"workingset_refault": 5000, "compact_stall": 0,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+
+	// older kernels have a single allocstall counter
+	got = getVMStatsFromString("allocstall 42\npgfault 10\n")
+	if got["allocstall"] != 42 || got["pgfault"] != 10 {
+		t.Errorf("Got %v", got)
+	}
+}
+
+func Test_getVMStatRates(t *testing.T) {
+	prev := map[string]int64{"pswpin": 100, "pswpout": 200, "oom_kill": 0}
+
+	var tests = []struct {
+		curr    map[string]int64
+		elapsed time.Duration
+		want    map[string]float64
+		wantOk  bool
+	}{
+		{map[string]int64{"pswpin": 400, "pswpout": 200, "oom_kill": 1, "pgfault": 10},
+			10 * time.Second, map[string]float64{"pswpin": 30, "pswpout": 0, "oom_kill": 0.1}, true},
+		{map[string]int64{"pswpin": 10, "pswpout": 200, "oom_kill": 0}, 10 * time.Second, nil, false},
+		{prev, 0, nil, false},
+	}
+
+	for i, tt := range tests {
+		testname := fmt.Sprintf("%d", i)
+		t.Run(testname, func(t *testing.T) {
+			got, ok := getVMStatRates(prev, tt.curr, tt.elapsed)
+			if ok != tt.wantOk {
+				t.Fatalf("Got ok %v, want %v", ok, tt.wantOk)
+			}
+			if ok && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package modules
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dpinato/pi-reporter/helper"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+const DefaultWirelessReportTime = 30 * time.Second
+const WirelessStatsPath = "/proc/net/wireless"
+const WirelessMeasurementsName = "wireless_stats"
+const IwCommandTimeout = 5 * time.Second
+
+// WirelessNoiseUnavailable is the noise level reported by drivers that do not measure it
+const WirelessNoiseUnavailable = -256
+
+// WirelessStats contains the link statistics of one wireless interface
+type WirelessStats struct {
+	IfName string
+
+	// from /proc/net/wireless
+	LinkQuality      float64
+	SignalLevel      float64 // dBm
+	NoiseLevel       float64 // dBm, WirelessNoiseUnavailable when not measured
+	DiscardedNwid    int64
+	DiscardedCrypt   int64
+	DiscardedFrag    int64
+	DiscardedRetry   int64
+	DiscardedMisc    int64
+	MissedBeacon     int64
+	HasLinkDetails   bool // true when the fields below were read from iw
+	Connected        bool
+	SSID             string
+	BSSID            string
+	Frequency        int64   // MHz
+	RxBitrate        float64 // Mbit/s
+	TxBitrate        float64 // Mbit/s
+	TxRetries        int64
+	TxFailed         int64
+	BeaconLossEvents int64
+}
+
+// runIw returns the output of iw for the arguments provided,
+// tests replace it with a fake that returns a sample output
+var runIw = func(args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), IwCommandTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "iw", args...).Output()
+	return string(out), err
+}
+
+func ReportWirelessStats(dbName, piName string, c client.Client) error {
+	log.Printf("ReportWirelessStats() is starting, %s\n", piName)
+
+	// without iw only the statistics in /proc/net/wireless are reported
+	_, err := exec.LookPath("iw")
+	iwAvailable := err == nil
+	if !iwAvailable {
+		log.Println("iw not found, SSID, bitrate and retries will not be reported")
+	}
+
+	ticker := time.NewTicker(DefaultWirelessReportTime)
+	for {
+		select {
+		case t := <-ticker.C:
+			data, err := ioutil.ReadFile(WirelessStatsPath)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+
+			for _, stat := range getWirelessStatsFromProc(string(data)) {
+				if iwAvailable {
+					err = getWirelessLinkDetails(&stat)
+					if err != nil {
+						log.Println(err)
+					}
+				}
+
+				err = reportWirelessStatsToInflux(dbName, piName, stat, t, c)
+				if err != nil {
+					log.Println(err)
+				}
+			}
+		}
+	}
+}
+
+func getWirelessStatsFromProc(data string) []WirelessStats {
+	// given the content of /proc/net/wireless, return the statistics of each interface
+	// the first two lines are headers, values may have a trailing dot
+	// wlan0: 0000   70.  -40.  -256        0      0      0      0      0        0
+	var output []WirelessStats
+	lines := strings.Split(data, "\n")
+	for i, line := range lines {
+		if i < 2 {
+			continue
+		}
+
+		pos := strings.Index(line, ":")
+		if pos == -1 {
+			continue
+		}
+		list := strings.Fields(line[pos+1:])
+		if len(list) < 10 {
+			continue
+		}
+
+		values := make([]float64, len(list))
+		for j, elem := range list {
+			values[j], _ = strconv.ParseFloat(strings.TrimSuffix(elem, "."), 64)
+		}
+
+		// list[0] is the status of the interface
+		output = append(output, WirelessStats{
+			IfName:         strings.TrimSpace(line[0:pos]),
+			LinkQuality:    values[1],
+			SignalLevel:    values[2],
+			NoiseLevel:     values[3],
+			DiscardedNwid:  int64(values[4]),
+			DiscardedCrypt: int64(values[5]),
+			DiscardedFrag:  int64(values[6]),
+			DiscardedRetry: int64(values[7]),
+			DiscardedMisc:  int64(values[8]),
+			MissedBeacon:   int64(values[9]),
+		})
+	}
+
+	return output
+}
+
+func getWirelessLinkDetails(stat *WirelessStats) error {
+	// get the SSID, BSSID, frequency and bitrates from iw link, and retries from iw station dump
+	out, err := runIw("dev", stat.IfName, "link")
+	if err != nil {
+		return err
+	}
+	stat.HasLinkDetails = true
+	getIwLinkFromString(out, stat)
+	if !stat.Connected {
+		return nil
+	}
+
+	out, err = runIw("dev", stat.IfName, "station", "dump")
+	if err != nil {
+		return err
+	}
+	getIwStationDumpFromString(out, stat)
+	return nil
+}
+
+func getIwLinkFromString(data string, stat *WirelessStats) {
+	// Connected to aa:bb:cc:dd:ee:ff (on wlan0)
+	//	SSID: MyNetwork
+	//	freq: 2437
+	//	tx bitrate: 65.0 MBit/s MCS 7 short GI
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "Connected to ") {
+			stat.Connected = true
+			list := strings.Fields(line)
+			stat.BSSID = list[2]
+			continue
+		}
+
+		key, value := splitIwLine(line)
+		switch key {
+		case "SSID":
+			stat.SSID = value
+		case "freq":
+			// newer versions of iw print decimals, e.g. 2437.0
+			freq, _ := strconv.ParseFloat(value, 64)
+			stat.Frequency = int64(freq)
+		case "rx bitrate":
+			stat.RxBitrate = parseIwBitrate(value)
+		case "tx bitrate":
+			stat.TxBitrate = parseIwBitrate(value)
+		}
+	}
+}
+
+func getIwStationDumpFromString(data string, stat *WirelessStats) {
+	// when connected to an access point, the station dump contains only the access point
+	for _, line := range strings.Split(data, "\n") {
+		key, value := splitIwLine(strings.TrimSpace(line))
+		switch key {
+		case "tx retries":
+			stat.TxRetries, _ = strconv.ParseInt(value, 10, 64)
+		case "tx failed":
+			stat.TxFailed, _ = strconv.ParseInt(value, 10, 64)
+		case "beacon loss":
+			stat.BeaconLossEvents, _ = strconv.ParseInt(value, 10, 64)
+		}
+	}
+}
+
+func splitIwLine(line string) (string, string) {
+	pos := strings.Index(line, ":")
+	if pos == -1 {
+		return "", ""
+	}
+	return line[0:pos], strings.TrimSpace(line[pos+1:])
+}
+
+func parseIwBitrate(value string) float64 {
+	// value is something like 65.0 MBit/s MCS 7 short GI
+	list := strings.Fields(value)
+	if len(list) == 0 {
+		return 0
+	}
+	bitrate, _ := strconv.ParseFloat(list[0], 64)
+	return bitrate
+}
+
+func reportWirelessStatsToInflux(dbName, piName string, stat WirelessStats, now time.Time, c client.Client) error {
+	tags := map[string]string{
+		"pi_name": piName,
+		"if_name": stat.IfName,
+	}
+	fields := map[string]interface{}{
+		"link_quality":    stat.LinkQuality,
+		"signal_level":    stat.SignalLevel,
+		"discarded_nwid":  stat.DiscardedNwid,
+		"discarded_crypt": stat.DiscardedCrypt,
+		"discarded_frag":  stat.DiscardedFrag,
+		"discarded_retry": stat.DiscardedRetry,
+		"discarded_misc":  stat.DiscardedMisc,
+		"missed_beacon":   stat.MissedBeacon,
+	}
+	if stat.NoiseLevel > WirelessNoiseUnavailable {
+		fields["noise_level"] = stat.NoiseLevel
+	}
+
+	if stat.HasLinkDetails {
+		fields["connected"] = stat.Connected
+		if stat.Connected {
+			fields["ssid"] = stat.SSID
+			fields["bssid"] = stat.BSSID
+			fields["frequency"] = stat.Frequency
+			fields["rx_bitrate"] = stat.RxBitrate
+			fields["tx_bitrate"] = stat.TxBitrate
+			fields["tx_retries"] = stat.TxRetries
+			fields["tx_failed"] = stat.TxFailed
+			fields["beacon_loss"] = stat.BeaconLossEvents
+		}
+	}
+
+	var dbInfoObj helper.DBInfo
+	dbInfoObj.DBName = dbName
+	dbInfoObj.MeasName = WirelessMeasurementsName
+	dbInfoObj.Tags = tags
+	dbInfoObj.Fields = fields
+	dbInfoObj.Now = now
+
+	err := helper.ReportStatsToInflux(dbInfoObj, c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
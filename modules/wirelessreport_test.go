@@ -0,0 +1,82 @@
+package modules
+
+import (
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_getWirelessStatsFromProc(t *testing.T) {
+	data, err := ioutil.ReadFile("../TestFiles/proc_net_wireless_sample.txt")
+	if err != nil {
+		t.Fatalf("Could not read sample file, %v\n", err)
+	}
+
+	got := getWirelessStatsFromProc(string(data))
+	want := []WirelessStats{
+		{IfName: "wlan0", LinkQuality: 58, SignalLevel: -52, NoiseLevel: -256, DiscardedRetry: 12, DiscardedMisc: 3},
+		{IfName: "wlan1", LinkQuality: 0, SignalLevel: -256, NoiseLevel: -256},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %+v, want %+v", got, want)
+	}
+}
+
+func Test_getWirelessLinkDetails(t *testing.T) {
+	link, err := ioutil.ReadFile("../TestFiles/iw_link_sample.txt")
+	if err != nil {
+		t.Fatalf("Could not read sample file, %v\n", err)
+	}
+	dump, err := ioutil.ReadFile("../TestFiles/iw_station_dump_sample.txt")
+	if err != nil {
+		t.Fatalf("Could not read sample file, %v\n", err)
+	}
+
+	origRunner := runIw
+	defer func() { runIw = origRunner }()
+
+	t.Run("connected", func(t *testing.T) {
+		runIw = func(args ...string) (string, error) {
+			switch strings.Join(args, " ") {
+			case "dev wlan0 link":
+				return string(link), nil
+			case "dev wlan0 station dump":
+				return string(dump), nil
+			}
+			return "", errors.New("unexpected arguments")
+		}
+
+		got := WirelessStats{IfName: "wlan0"}
+		err := getWirelessLinkDetails(&got)
+		if err != nil {
+			t.Fatalf("Got error, %v\n", err)
+		}
+
+		want := WirelessStats{IfName: "wlan0", HasLinkDetails: true, Connected: true, SSID: "Site Network",
+			BSSID: "b8:27:eb:12:34:56", Frequency: 5180, RxBitrate: 433.3, TxBitrate: 390,
+			TxRetries: 1543, TxFailed: 12, BeaconLossEvents: 2}
+		if got != want {
+			t.Errorf("Got %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("not connected", func(t *testing.T) {
+		runIw = func(args ...string) (string, error) {
+			if strings.Join(args, " ") == "dev wlan0 link" {
+				return "Not connected.\n", nil
+			}
+			return "", errors.New("station dump should not be called")
+		}
+
+		got := WirelessStats{IfName: "wlan0"}
+		err := getWirelessLinkDetails(&got)
+		if err != nil {
+			t.Fatalf("Got error, %v\n", err)
+		}
+		if got.Connected || !got.HasLinkDetails {
+			t.Errorf("Got %+v, want not connected", got)
+		}
+	})
+}
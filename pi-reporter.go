@@ -3,10 +3,17 @@ package main
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
+	"time"
 
+	"github.com/dpinato/pi-reporter/helper"
 	"github.com/dpinato/pi-reporter/modules"
 	client "github.com/influxdata/influxdb1-client/v2"
 )
@@ -16,7 +23,37 @@ const LogFilePath = "/var/log/pi-reporter.log"
 // SupportedArgs:
 // --env: Indicates the environment type, i.e. dev or prod
 // --influxhost: IP address of the host running InfluxDB
-var SupportedArgs = []string{"--env", "--influxhost"}
+// --diskraw: (optional) "true" to also report the raw /proc/diskstats counters
+// --netinclude: (optional) comma-separated interface globs to report, "re:" for regular expressions
+// --netexclude: (optional) comma-separated interface globs to ignore, "re:" for regular expressions
+// --netvirtual: (optional) "true" to also report virtual interfaces
+// --name: (optional) name used to identify this PI
+// --identity: (optional) comma-separated strategies to resolve the name of this PI, in order
+// --tags: (optional) comma-separated key=value tags added to every point
+// --measurementtags: (optional) comma-separated measurement:key=value tags added to one measurement
+// --inventory: (optional) "true" to add tags describing the hardware and software of this PI
+// --fsinclude: (optional) comma-separated mount point globs to report, "re:" for regular expressions
+// --fsexclude: (optional) comma-separated mount point globs to ignore, "re:" for regular expressions
+// --fstypeexclude: (optional) comma-separated filesystem types to ignore, replaces the default list
+// --procnames: (optional) comma-separated process name globs always reported, "re:" for regular expressions
+// --proctopn: (optional) number of processes reported by CPU and by memory usage
+// --units: (optional) comma-separated systemd units to report the state of
+// --probes: (optional) comma-separated probe targets, e.g. icmp:8.8.8.8,tcp:host:443,http:https://host/,dns:name
+// --probesfile: (optional) file listing one probe target per line, for targets containing commas
+// --wantargets: (optional) comma-separated probe targets telling whether the WAN is reachable, e.g. icmp:1.1.1.1
+// --wantargetsfile: (optional) file listing one WAN probe target per line, for targets containing commas
+// --cgroups: (optional) comma-separated cgroup path globs to report on top of containers and slices, "re:" for regular expressions
+// --execconfig: (optional) file listing the commands whose output is reported, see modules.ParseExecConfig
+// --textfiledir: (optional) directory of *.prom and *.lp files whose metrics are reported
+// --textfilemaxage: (optional) age after which files in --textfiledir are ignored, e.g. 10m
+// --kmsgpatterns: (optional) comma-separated kernel log patterns counted on top of the defaults, e.g. usb_reset=re:usb .*reset
+// --kmsgpatternsfile: (optional) file listing one kernel log pattern per line, for patterns containing commas
+// --mmcstate: (optional) file keeping the bytes written to the SD card across restarts
+var SupportedArgs = []string{"--env", "--influxhost", "--diskraw", "--netinclude", "--netexclude", "--netvirtual",
+	"--name", "--identity", "--tags", "--measurementtags", "--inventory", "--fsinclude", "--fsexclude",
+	"--fstypeexclude", "--procnames", "--proctopn", "--units", "--probes", "--probesfile",
+	"--wantargets", "--wantargetsfile", "--cgroups", "--execconfig", "--textfiledir",
+	"--textfilemaxage", "--kmsgpatterns", "--kmsgpatternsfile", "--mmcstate"}
 
 // constants for InfluxDB connection
 const (
@@ -56,6 +93,110 @@ func main() {
 		log.Fatalln("Bad environment selected, terminating ...")
 	}
 
+	// optional collector settings
+	modules.DiskReportRawCounters = args["--diskraw"] == "true"
+	modules.NetIfIncludePatterns = splitArgList(args["--netinclude"])
+	modules.NetIfExcludePatterns = splitArgList(args["--netexclude"])
+	modules.NetIfIncludeVirtual = args["--netvirtual"] == "true"
+	modules.FSMountIncludePatterns = splitArgList(args["--fsinclude"])
+	modules.FSMountExcludePatterns = splitArgList(args["--fsexclude"])
+	if args["--fstypeexclude"] != "" {
+		modules.FSTypeExcludePatterns = splitArgList(args["--fstypeexclude"])
+	}
+	modules.ProcNamePatterns = splitArgList(args["--procnames"])
+	if args["--proctopn"] != "" {
+		topN, err := strconv.Atoi(args["--proctopn"])
+		if err != nil || topN < 0 {
+			log.Fatalf("Bad --proctopn value, %s\n", args["--proctopn"])
+		}
+		modules.ProcTopN = topN
+	}
+	modules.SystemdUnits = splitArgList(args["--units"])
+	modules.CgroupIncludePatterns = splitArgList(args["--cgroups"])
+	if args["--execconfig"] != "" {
+		data, err := ioutil.ReadFile(args["--execconfig"])
+		if err != nil {
+			log.Fatalf("Failed to read --execconfig, %v\n", err)
+		}
+		modules.ExecCommands, err = modules.ParseExecConfig(string(data))
+		if err != nil {
+			log.Fatalf("Bad --execconfig file, %v\n", err)
+		}
+	}
+	// targets are split on commas, URLs containing commas go in a file with one target per line
+	probeTargets, err := modules.ParseProbeTargets(splitArgList(args["--probes"]))
+	if err != nil {
+		log.Fatalf("Bad --probes value, %v\n", err)
+	}
+	modules.ProbeTargets = probeTargets
+	if args["--probesfile"] != "" {
+		probeTargets, err = modules.ParseProbeTargets(readArgListFile(args["--probesfile"]))
+		if err != nil {
+			log.Fatalf("Bad --probesfile file, %v\n", err)
+		}
+		modules.ProbeTargets = append(modules.ProbeTargets, probeTargets...)
+	}
+	wanTargets, err := modules.ParseProbeTargets(splitArgList(args["--wantargets"]))
+	if err != nil {
+		log.Fatalf("Bad --wantargets value, %v\n", err)
+	}
+	modules.RouteWANTargets = wanTargets
+	if args["--wantargetsfile"] != "" {
+		wanTargets, err = modules.ParseProbeTargets(readArgListFile(args["--wantargetsfile"]))
+		if err != nil {
+			log.Fatalf("Bad --wantargetsfile file, %v\n", err)
+		}
+		modules.RouteWANTargets = append(modules.RouteWANTargets, wanTargets...)
+	}
+
+	modules.TextfileDir = args["--textfiledir"]
+	if args["--textfilemaxage"] != "" {
+		maxAge, err := time.ParseDuration(args["--textfilemaxage"])
+		if err != nil || maxAge <= 0 {
+			log.Fatalf("Bad --textfilemaxage value, %s\n", args["--textfilemaxage"])
+		}
+		modules.TextfileMaxAge = maxAge
+	}
+
+	kmsgPatterns, err := modules.ParseKmsgPatterns(splitArgList(args["--kmsgpatterns"]))
+	if err != nil {
+		log.Fatalf("Bad --kmsgpatterns value, %v\n", err)
+	}
+	modules.KmsgPatterns = append(modules.KmsgPatterns, kmsgPatterns...)
+	if args["--kmsgpatternsfile"] != "" {
+		kmsgPatterns, err = modules.ParseKmsgPatterns(readArgListFile(args["--kmsgpatternsfile"]))
+		if err != nil {
+			log.Fatalf("Bad --kmsgpatternsfile file, %v\n", err)
+		}
+		modules.KmsgPatterns = append(modules.KmsgPatterns, kmsgPatterns...)
+	}
+
+	if args["--mmcstate"] != "" {
+		modules.MMCStateFile = args["--mmcstate"]
+	}
+
+	// resolve the name of this PI once, it is shared by all collectors
+	strategies := helper.DefaultIdentityStrategies
+	if args["--identity"] != "" {
+		strategies = splitArgList(args["--identity"])
+	}
+	piName, err := helper.ResolvePIName(strategies, args["--name"])
+	if err != nil {
+		log.Fatalf("Failed to resolve the name of this PI, %v\n", err)
+	}
+	log.Printf("Reporting as %s\n", piName)
+
+	// static tags
+	helper.GlobalTags = parseTagList(args["--tags"])
+	if args["--inventory"] == "true" {
+		for k, v := range helper.GetInventoryTags() {
+			if _, ok := helper.GlobalTags[k]; !ok {
+				helper.GlobalTags[k] = v
+			}
+		}
+	}
+	helper.MeasurementTags = parseMeasurementTagList(args["--measurementtags"])
+
 	// connect to InfluxDB
 	influxDBHost := args["--influxhost"]
 	c, err := influxDBClient(influxDBHost, InfluxDBPort)
@@ -65,6 +206,16 @@ func main() {
 	defer c.Close()
 	log.Printf("Connected to DB %s:%s\n", influxDBHost, InfluxDBPort)
 
+	// collectors register hooks with helper.OnShutdown to save their state before pi-reporter exits
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		sig := <-sigs
+		log.Printf("Received %v, pi-reporter is ending ...\n", sig)
+		helper.RunShutdownHooks()
+		os.Exit(0)
+	}()
+
 	// start reporting
 	var wg sync.WaitGroup
 
@@ -73,11 +224,28 @@ func main() {
 		// these routines should all run at the same time anyway
 		// TODO: should use a channel to listen for an error that breaks the routine
 		defer wg.Done()
-		go modules.ReportCPUUsage(influxDBName, c)
-		go modules.ReportNetworkStats(influxDBName, c)
-		go modules.ReportTempStats(influxDBName, c)
-		go modules.ReportMemoryStats(influxDBName, c)
-		modules.ReportDiskStats(influxDBName, c)
+		go modules.ReportCPUUsage(influxDBName, piName, c)
+		go modules.ReportCPUFreqStats(influxDBName, piName, c)
+		go modules.ReportNetworkStats(influxDBName, piName, c)
+		go modules.ReportWirelessStats(influxDBName, piName, c)
+		go modules.ReportProtoStats(influxDBName, piName, c)
+		go modules.ReportRouteStats(influxDBName, piName, c)
+		go modules.ReportTempStats(influxDBName, piName, c)
+		go modules.ReportPowerSupplyStats(influxDBName, piName, c)
+		go modules.ReportMemoryStats(influxDBName, piName, c)
+		go modules.ReportVMStats(influxDBName, piName, c)
+		go modules.ReportSystemStats(influxDBName, piName, c)
+		go modules.ReportFSStats(influxDBName, piName, c)
+		go modules.ReportMMCStats(influxDBName, piName, c)
+		go modules.ReportPSIStats(influxDBName, piName, c)
+		go modules.ReportProcStats(influxDBName, piName, c)
+		go modules.ReportSystemdStats(influxDBName, piName, c)
+		go modules.ReportCgroupStats(influxDBName, piName, c)
+		go modules.ReportExecStats(influxDBName, piName, c)
+		go modules.ReportTextfileStats(influxDBName, piName, c)
+		go modules.ReportKmsgStats(influxDBName, piName, c)
+		go modules.ReportProbes(influxDBName, piName, c)
+		modules.ReportDiskStats(influxDBName, piName, c)
 	}(&wg)
 
 	wg.Wait()
@@ -104,6 +272,72 @@ func parseCmdArgs(args []string) map[string]string {
 	return output
 }
 
+func splitArgList(arg string) []string {
+	// split a comma-separated argument value, ignoring empty elements
+	output := []string{}
+	for _, elem := range strings.Split(arg, ",") {
+		elem = strings.TrimSpace(elem)
+		if elem != "" {
+			output = append(output, elem)
+		}
+	}
+
+	return output
+}
+
+func readArgListFile(path string) []string {
+	// read a file with one element per line, ignoring empty lines and lines starting with #
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Failed to read %s, %v\n", path, err)
+	}
+
+	output := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			output = append(output, line)
+		}
+	}
+
+	return output
+}
+
+func parseTagList(arg string) map[string]string {
+	// parse a comma-separated list of key=value tags
+	output := make(map[string]string)
+	for _, elem := range splitArgList(arg) {
+		pos := strings.Index(elem, "=")
+		if pos <= 0 || pos == len(elem)-1 {
+			log.Fatalf("Bad tag %s, expected key=value\n", elem)
+		}
+		output[elem[0:pos]] = elem[pos+1:]
+	}
+
+	return output
+}
+
+func parseMeasurementTagList(arg string) map[string]map[string]string {
+	// parse a comma-separated list of measurement:key=value tags
+	output := make(map[string]map[string]string)
+	for _, elem := range splitArgList(arg) {
+		pos := strings.Index(elem, ":")
+		if pos <= 0 {
+			log.Fatalf("Bad measurement tag %s, expected measurement:key=value\n", elem)
+		}
+
+		measName := elem[0:pos]
+		if _, ok := output[measName]; !ok {
+			output[measName] = make(map[string]string)
+		}
+		for k, v := range parseTagList(elem[pos+1:]) {
+			output[measName][k] = v
+		}
+	}
+
+	return output
+}
+
 func validateCmdArgs(args map[string]string) bool {
 	// return true if the arguments provided are within the list of supported arguments
 	for k, v := range args {